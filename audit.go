@@ -0,0 +1,70 @@
+package lmdbstore
+
+import (
+	"errors"
+	"time"
+
+	"github.com/bmatsuo/lmdb-go/lmdb"
+)
+
+// ErrAuditNotEnabled is returned by PutAudited and CreatedAt on databases without DbConfig.Audited
+var ErrAuditNotEnabled = errors.New("audit is not enabled for this database")
+
+// PutAudited puts a value with key inside the database,
+// recording the current time as the creation time of key if it has none
+//
+// Updates of an existing key leave its creation time unchanged.
+// The write and the creation time are committed in a single transaction
+//
+// The call will block until the transaction is finished
+//
+func (s *Db) PutAudited(key []byte, value interface{}) error {
+	if !s.audited {
+		return ErrAuditNotEnabled
+	}
+	return s.update(func(txn *lmdb.Txn) error {
+		err := s.putValue(txn, key, value)
+		if err != nil {
+			return err
+		}
+		err = txn.Put(s.createdDbi, key, TimeKey(time.Now()), lmdb.NoOverwrite)
+		if lmdb.IsErrno(err, lmdb.KeyExist) {
+			return nil
+		}
+		return err
+	})
+}
+
+// CreatedAt returns the time key was first written by PutAudited
+//
+// If key has no creation time, ErrNotFound is returned
+//
+func (s *Db) CreatedAt(key []byte) (createdAt time.Time, err error) {
+	if !s.audited {
+		return time.Time{}, ErrAuditNotEnabled
+	}
+	err = s.lmdbEnv.View(func(txn *lmdb.Txn) error {
+		b, err := txn.Get(s.createdDbi, key)
+		if lmdb.IsNotFound(err) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		createdAt = KeyTime(b)
+		return nil
+	})
+	return createdAt, err
+}
+
+// clearCreated removes the creation time of key inside txn, if any
+func (s *Db) clearCreated(txn *lmdb.Txn, key []byte) error {
+	if !s.audited {
+		return nil
+	}
+	err := txn.Del(s.createdDbi, key, nil)
+	if lmdb.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,57 @@
+package lmdbstore
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPutAudited(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a", Audited: true}).GetDatabase("a")
+	if _, err := db.CreatedAt([]byte("k")); err != ErrNotFound {
+		t.Fatalf("CreatedAt before the first write: %v, want ErrNotFound", err)
+	}
+	before := time.Now()
+	if err := db.PutAudited([]byte("k"), []byte("v1")); err != nil {
+		t.Fatal(err)
+	}
+	created, err := db.ReadOnly().CreatedAt([]byte("k"))
+	if err != nil || created.Before(before) || created.After(time.Now()) {
+		t.Fatalf("CreatedAt = %v, %v, want between %v and now", created, err, before)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	if err := db.PutAudited([]byte("k"), []byte("v2")); err != nil {
+		t.Fatal(err)
+	}
+	mustPut(t, db, "k", []byte("v3"))
+	if got, err := db.CreatedAt([]byte("k")); err != nil || !got.Equal(created) {
+		t.Fatalf("CreatedAt after updates = %v, %v, want %v", got, err, created)
+	}
+	if got := mustGet(t, db, "k"); got != "v3" {
+		t.Fatalf("value = %q, want v3", got)
+	}
+
+	// deleting clears the creation time, so a new write records a new one
+	if err := db.Del([]byte("k")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.CreatedAt([]byte("k")); err != ErrNotFound {
+		t.Fatalf("CreatedAt after Del: %v, want ErrNotFound", err)
+	}
+	if err := db.PutAudited([]byte("k"), []byte("v4")); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := db.CreatedAt([]byte("k")); err != nil || !got.After(created) {
+		t.Fatalf("CreatedAt after re-creating = %v, %v, want after %v", got, err, created)
+	}
+}
+
+func TestPutAuditedNotEnabled(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	if err := db.PutAudited([]byte("k"), []byte("v")); err != ErrAuditNotEnabled {
+		t.Fatalf("PutAudited: %v, want ErrAuditNotEnabled", err)
+	}
+	if _, err := db.CreatedAt([]byte("k")); err != ErrAuditNotEnabled {
+		t.Fatalf("CreatedAt: %v, want ErrAuditNotEnabled", err)
+	}
+}
@@ -0,0 +1,179 @@
+package lmdbstore
+
+import (
+	"errors"
+	"hash/fnv"
+	"sync"
+
+	"github.com/bmatsuo/lmdb-go/lmdb"
+)
+
+const (
+	// bloomBitsPerKey gives about 1% false positives at the sized number of keys
+	bloomBitsPerKey = 10
+	bloomHashes     = 7
+	// bloomMinKeys sizes filters of small databases for some growth
+	bloomMinKeys = 1024
+)
+
+// bloomFilter is a fixed size bloom filter safe for concurrent use
+type bloomFilter struct {
+	mu   sync.RWMutex
+	bits []uint64
+	// set by raw writes the filter cannot see, makes every key possibly present
+	stale bool
+}
+
+// newBloomFilter returns a filter sized for twice the number of keys
+func newBloomFilter(keys uint64) *bloomFilter {
+	keys *= 2
+	if keys < bloomMinKeys {
+		keys = bloomMinKeys
+	}
+	return &bloomFilter{bits: make([]uint64, (keys*bloomBitsPerKey+63)/64)}
+}
+
+// bloomHash returns the fnv-1a hash of key, split into the two hashes of bloomFilter.locations
+func bloomHash(key []byte) (h1, h2 uint64) {
+	h := fnv.New64a()
+	h.Write(key)
+	sum := h.Sum64()
+	return sum & 0xffffffff, sum>>32 | 1
+}
+
+// locations returns the bit positions of the hashes of a key, using double hashing,
+// called with f.mu held as the size changes on rebuild
+func (f *bloomFilter) locations(h1, h2 uint64) [bloomHashes]uint64 {
+	n := uint64(len(f.bits)) * 64
+	var locs [bloomHashes]uint64
+	for i := range locs {
+		locs[i] = (h1 + uint64(i)*h2) % n
+	}
+	return locs
+}
+
+func (f *bloomFilter) add(key []byte) {
+	h1, h2 := bloomHash(key)
+	f.mu.Lock()
+	for _, loc := range f.locations(h1, h2) {
+		f.bits[loc/64] |= 1 << (loc % 64)
+	}
+	f.mu.Unlock()
+}
+
+// mayContain reports false only if key was never added
+func (f *bloomFilter) mayContain(key []byte) bool {
+	h1, h2 := bloomHash(key)
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if f.stale {
+		return true
+	}
+	for _, loc := range f.locations(h1, h2) {
+		if f.bits[loc/64]&(1<<(loc%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// ErrBloomFilterNotEnabled is returned by RebuildBloomFilter on databases without DbConfig.BloomFilter
+var ErrBloomFilterNotEnabled = errors.New("bloom filter is not enabled for this database")
+
+// invalidate makes the filter report every key as possibly present
+func (f *bloomFilter) invalidate() {
+	f.mu.Lock()
+	f.stale = true
+	f.mu.Unlock()
+}
+
+// buildBloomFilter scans every key of the database into a new bloom filter
+func (s *Db) buildBloomFilter() error {
+	return s.lmdbEnv.View(func(txn *lmdb.Txn) error {
+		bloom, err := s.scanBloomFilter(txn)
+		if err != nil {
+			return err
+		}
+		s.bloom = bloom
+		return nil
+	})
+}
+
+// scanBloomFilter returns a new bloom filter of every key of the database inside txn
+func (s *Db) scanBloomFilter(txn *lmdb.Txn) (*bloomFilter, error) {
+	stat, err := txn.Stat(s.dbi)
+	if err != nil {
+		return nil, err
+	}
+	bloom := newBloomFilter(stat.Entries)
+	err = s.walkRangeRaw(txn, nil, nil, func(key, value []byte) error {
+		bloom.add(key)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return bloom, nil
+}
+
+// RebuildBloomFilter scans every key of the database into a new bloom filter,
+// enabling the filter again after raw writes disabled it
+//
+// The scan runs in a write transaction, so no write is missed while it runs
+//
+// The call will block until the transaction is finished
+//
+func (s *Db) RebuildBloomFilter() error {
+	if s.bloom == nil {
+		return ErrBloomFilterNotEnabled
+	}
+	return s.update(func(txn *lmdb.Txn) error {
+		bloom, err := s.scanBloomFilter(txn)
+		if err != nil {
+			return err
+		}
+		s.bloom.mu.Lock()
+		s.bloom.bits, s.bloom.stale = bloom.bits, false
+		s.bloom.mu.Unlock()
+		return nil
+	})
+}
+
+// invalidateBloomFilter disables the bloom filter of the database, if any,
+// called inside write transactions before raw writes
+func (s *Db) invalidateBloomFilter() {
+	if s.bloom != nil {
+		s.bloom.invalidate()
+	}
+}
+
+// invalidateBloomFilters disables the bloom filters of every database
+func (l *LmdbEnv) invalidateBloomFilters() {
+	for _, db := range l.databases {
+		db.invalidateBloomFilter()
+	}
+}
+
+// definitelyAbsent reports whether the bloom filter rules out key
+func (s *Db) definitelyAbsent(key []byte) bool {
+	return s.bloom != nil && !s.bloom.mayContain(key)
+}
+
+// Exists reports whether key exists inside the database
+//
+// With DbConfig.BloomFilter, most absent keys are answered without opening a transaction
+//
+func (s *Db) Exists(key []byte) (exists bool, err error) {
+	if s.definitelyAbsent(key) {
+		return false, nil
+	}
+	err = s.lmdbEnv.View(func(txn *lmdb.Txn) error {
+		_, err := s.get(txn, key)
+		if err == ErrNotFound {
+			return nil
+		}
+		exists = err == nil
+		return err
+	})
+	return exists, err
+}
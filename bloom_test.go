@@ -0,0 +1,86 @@
+package lmdbstore
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/bmatsuo/lmdb-go/lmdb"
+)
+
+func TestBloomFilterNoFalseNegatives(t *testing.T) {
+	config := DefaultLmdbConfig
+	config.OpenPath = t.TempDir()
+	env := reopen(t, nil, config, DbConfig{DbName: "a"})
+	defer func() { env.Close() }()
+	// written before the filter is enabled, added by the scan on open
+	putNumbered(t, env.GetDatabase("a"), "old", 3000)
+	env = reopen(t, env, config, DbConfig{DbName: "a", BloomFilter: true})
+	db := env.GetDatabase("a")
+	putNumbered(t, db, "new", 3000)
+	for _, prefix := range []string{"old", "new"} {
+		for i := 0; i < 3000; i++ {
+			key := []byte(fmt.Sprintf("%s%03d", prefix, i))
+			if ok, err := db.Exists(key); err != nil || !ok {
+				t.Fatalf("%s: exists %v, %v", key, ok, err)
+			}
+		}
+	}
+
+	// most misses are answered by the filter without a View
+	absent := 0
+	for i := 0; i < 1000; i++ {
+		key := []byte(fmt.Sprintf("missing%d", i))
+		if db.definitelyAbsent(key) {
+			absent++
+		}
+		if ok, err := db.Exists(key); err != nil || ok {
+			t.Fatalf("%s: exists %v, %v", key, ok, err)
+		}
+	}
+	if absent < 900 {
+		t.Fatalf("filter ruled out %d of 1000 misses", absent)
+	}
+	// deleted keys fall through to a real lookup
+	if err := db.Del([]byte("new000")); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := db.Exists([]byte("new000")); err != nil || ok {
+		t.Fatalf("deleted key: exists %v, %v", ok, err)
+	}
+}
+
+func TestBloomFilterRawWrites(t *testing.T) {
+	env := newTestEnv(t, DbConfig{DbName: "a", BloomFilter: true}, DbConfig{DbName: "plain"})
+	db := env.GetDatabase("a")
+	err := db.UpdateTxn(func(txn *lmdb.Txn) error {
+		return txn.Put(db.dbi, []byte("raw"), []byte("v"), 0)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := mustGet(t, db, "raw"); got != "v" {
+		t.Fatalf("raw write = %q", got)
+	}
+	if err := db.RebuildBloomFilter(); err != nil {
+		t.Fatal(err)
+	}
+	if db.definitelyAbsent([]byte("raw")) {
+		t.Fatal("rebuilt filter is missing the raw write")
+	}
+	if !db.definitelyAbsent([]byte("missing")) {
+		t.Fatal("rebuilt filter is still disabled")
+	}
+
+	err = env.Transaction(func(tx *Tx) error {
+		return tx.Txn.Put(db.dbi, []byte("tx"), []byte("v"), 0)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := db.Exists([]byte("tx")); err != nil || !ok {
+		t.Fatalf("write through Tx.Txn: exists %v, %v", ok, err)
+	}
+	if err := env.GetDatabase("plain").RebuildBloomFilter(); err != ErrBloomFilterNotEnabled {
+		t.Fatalf("err = %v, want ErrBloomFilterNotEnabled", err)
+	}
+}
@@ -0,0 +1,147 @@
+package lmdbstore
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/bmatsuo/lmdb-go/lmdb"
+)
+
+// ErrChangelogNotEnabled is returned by Changes and TrimChanges without LmdbEnvConfig.Changelog
+var ErrChangelogNotEnabled = errors.New("changelog is not enabled for the environment")
+
+// OpKind is the kind of write recorded in the changelog
+type OpKind byte
+
+const (
+	// OpPut is a key written by a put
+	OpPut OpKind = iota + 1
+	// OpDel is a key deleted by a delete, an eviction or PurgeExpired
+	OpDel
+	// OpDrop is a database emptied by Drop, DropAll, TruncateAndReset or Compact, its key is empty
+	OpDrop
+)
+
+// String returns the name of the OpKind
+func (op OpKind) String() string {
+	switch op {
+	case OpPut:
+		return "put"
+	case OpDel:
+		return "del"
+	case OpDrop:
+		return "drop"
+	}
+	return fmt.Sprintf("OpKind(%d)", byte(op))
+}
+
+// recordChange appends a write of key inside db to the changelog inside txn
+//
+// Changelog keys are the 8 byte transaction ID followed by a 4 byte index inside the transaction,
+// values are the op, the uvarint length of the database name, the name and the key
+//
+func (l *LmdbEnv) recordChange(txn *lmdb.Txn, db *Db, op OpKind, key []byte) error {
+	if !l.changelog {
+		return nil
+	}
+	changeKey := make([]byte, 12)
+	binary.BigEndian.PutUint64(changeKey, uint64(txn.ID()))
+	cur, err := txn.OpenCursor(l.changelogDbi)
+	if err != nil {
+		return err
+	}
+	last, _, err := cur.Get(nil, nil, lmdb.Last)
+	cur.Close()
+	if err != nil && !lmdb.IsNotFound(err) {
+		return err
+	}
+	if err == nil && binary.BigEndian.Uint64(last) == uint64(txn.ID()) {
+		binary.BigEndian.PutUint32(changeKey[8:], binary.BigEndian.Uint32(last[8:])+1)
+	}
+	value := make([]byte, 1+binary.MaxVarintLen64, 1+binary.MaxVarintLen64+len(db.name)+len(key))
+	value[0] = byte(op)
+	value = value[:1+binary.PutUvarint(value[1:], uint64(len(db.name)))]
+	value = append(value, db.name...)
+	value = append(value, key...)
+	return txn.Put(l.changelogDbi, changeKey, value, lmdb.Append)
+}
+
+// Changes calls fn in order for every write recorded in the changelog
+// by transactions with an ID greater than since
+//
+// Pass the last txnID seen, or a LastTxnID checkpoint, as since to resume incrementally.
+// A database emptied by Drop, DropAll, TruncateAndReset or Compact is recorded as OpDrop with an empty key,
+// every earlier change of that database is superseded by it.
+// Writes done directly on lmdb.Txn, through Db.UpdateTxn, Db.UpdateCursorDo, Tx.Txn or Migration.Apply,
+// are not recorded.
+// The key passed to fn is only valid until fn returns, copy it to retain it.
+// Iteration stops at the first error returned by fn,
+// returning ErrStopIteration stops without an error
+//
+func (l *LmdbEnv) Changes(since int64, fn func(txnID int64, dbName string, key []byte, op OpKind) error) error {
+	if !l.changelog {
+		return ErrChangelogNotEnabled
+	}
+	start := make([]byte, 8)
+	binary.BigEndian.PutUint64(start, uint64(since)+1)
+	return l.LmdbEnv.View(func(txn *lmdb.Txn) error {
+		cur, err := txn.OpenCursor(l.changelogDbi)
+		if err != nil {
+			return err
+		}
+		defer cur.Close()
+		k, v, err := cur.Get(start, nil, lmdb.SetRange)
+		for ; err == nil; k, v, err = cur.Get(nil, nil, lmdb.Next) {
+			nameLen, n := binary.Uvarint(v[1:])
+			if n <= 0 || uint64(len(v)-1-n) < nameLen {
+				return fmt.Errorf("malformed changelog entry at txn %d", binary.BigEndian.Uint64(k))
+			}
+			name := string(v[1+n : 1+n+int(nameLen)])
+			err = fn(int64(binary.BigEndian.Uint64(k)), name, v[1+n+int(nameLen):], OpKind(v[0]))
+			if err == ErrStopIteration {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if lmdb.IsNotFound(err) {
+			return nil
+		}
+		return err
+	})
+}
+
+// TrimChanges deletes the changelog entries of transactions with an ID lower than or equal to before
+//
+// Returns the number of entries deleted
+//
+// The call will block until the transaction is finished
+//
+func (l *LmdbEnv) TrimChanges(before int64) (trimmed int, err error) {
+	if !l.changelog {
+		return 0, ErrChangelogNotEnabled
+	}
+	err = l.updateTxn(func(txn *lmdb.Txn) error {
+		trimmed = 0
+		cur, err := txn.OpenCursor(l.changelogDbi)
+		if err != nil {
+			return err
+		}
+		defer cur.Close()
+		k, _, err := cur.Get(nil, nil, lmdb.First)
+		for ; err == nil && int64(binary.BigEndian.Uint64(k)) <= before; k, _, err = cur.Get(nil, nil, lmdb.Next) {
+			err = cur.Del(0)
+			if err != nil {
+				return err
+			}
+			trimmed++
+		}
+		if err != nil && !lmdb.IsNotFound(err) {
+			return err
+		}
+		return nil
+	})
+	return trimmed, err
+}
@@ -0,0 +1,107 @@
+package lmdbstore
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// changesSince returns the changes after since as "db/key:op"
+func changesSince(t *testing.T, env *LmdbEnv, since int64) string {
+	t.Helper()
+	var changes []string
+	last := since
+	err := env.Changes(since, func(txnID int64, dbName string, key []byte, op OpKind) error {
+		if txnID < last {
+			return fmt.Errorf("txn %d after txn %d", txnID, last)
+		}
+		last = txnID
+		changes = append(changes, fmt.Sprintf("%s/%s:%s", dbName, key, op))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Join(changes, " ")
+}
+
+func TestChanges(t *testing.T) {
+	config := DefaultLmdbConfig
+	config.Databases = []DbConfig{{DbName: "a"}, {DbName: "b"}}
+	config.Changelog = true
+	env := newTestEnvConfig(t, config)
+	a, b := env.GetDatabase("a"), env.GetDatabase("b")
+	mustPut(t, a, "k1", []byte("v"))
+	mustPut(t, b, "k2", []byte("v"))
+	if err := a.Del([]byte("k1")); err != nil {
+		t.Fatal(err)
+	}
+	checkpoint, err := env.LastTxnID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustPut(t, a, "k3", []byte("v"))
+	if err := b.Del([]byte("k2")); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Drop(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := changesSince(t, env, 0), "a/k1:put b/k2:put a/k1:del a/k3:put b/k2:del a/:drop"; got != want {
+		t.Fatalf("all changes = %s, want %s", got, want)
+	}
+	if got, want := changesSince(t, env, checkpoint), "a/k3:put b/k2:del a/:drop"; got != want {
+		t.Fatalf("changes since the checkpoint = %s, want %s", got, want)
+	}
+
+	trimmed, err := env.TrimChanges(checkpoint)
+	if err != nil || trimmed != 3 {
+		t.Fatalf("TrimChanges = %d, %v, want 3", trimmed, err)
+	}
+	if got, want := changesSince(t, env, 0), "a/k3:put b/k2:del a/:drop"; got != want {
+		t.Fatalf("changes after trimming = %s, want %s", got, want)
+	}
+}
+
+func TestChangesInOneTransaction(t *testing.T) {
+	config := DefaultLmdbConfig
+	config.Databases = []DbConfig{{DbName: "a"}}
+	config.Changelog = true
+	env := newTestEnvConfig(t, config)
+	db := env.GetDatabase("a")
+	// several writes in one transaction keep their order
+	err := env.Transaction(func(tx *Tx) error {
+		for _, key := range []string{"c", "a", "b"} {
+			if err := tx.Put(db, []byte(key), []byte("v")); err != nil {
+				return err
+			}
+		}
+		return tx.Del(db, []byte("a"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := changesSince(t, env, 0), "a/c:put a/a:put a/b:put a/a:del"; got != want {
+		t.Fatalf("changes = %s, want %s", got, want)
+	}
+	count := 0
+	err = env.Changes(0, func(txnID int64, dbName string, key []byte, op OpKind) error {
+		count++
+		return ErrStopIteration
+	})
+	if err != nil || count != 1 {
+		t.Fatalf("ErrStopIteration: %d changes, %v", count, err)
+	}
+}
+
+func TestChangelogNotEnabled(t *testing.T) {
+	env := newTestEnv(t, DbConfig{DbName: "a"})
+	err := env.Changes(0, func(txnID int64, dbName string, key []byte, op OpKind) error { return nil })
+	if err != ErrChangelogNotEnabled {
+		t.Fatalf("Changes: %v, want ErrChangelogNotEnabled", err)
+	}
+	if _, err := env.TrimChanges(0); err != ErrChangelogNotEnabled {
+		t.Fatalf("TrimChanges: %v, want ErrChangelogNotEnabled", err)
+	}
+}
@@ -0,0 +1,48 @@
+package lmdbstore
+
+import (
+	"errors"
+
+	"github.com/shamaton/msgpack/v2"
+)
+
+// Codec is a pair of Marshal and Unmarshal functions used by DbConfig.Codecs
+type Codec struct {
+	Marshal   func(v interface{}) ([]byte, error)
+	Unmarshal func(data []byte, v interface{}) error
+}
+
+var (
+	// MsgpackArrayCodec is the default codec, encoding structs as msgpack arrays of their fields
+	MsgpackArrayCodec = Codec{Marshal: msgpack.MarshalAsArray, Unmarshal: msgpack.UnmarshalAsArray}
+	// MsgpackMapCodec encodes structs as msgpack maps keyed by field name, selected by DbConfig.MsgpackMapMode
+	MsgpackMapCodec = Codec{Marshal: msgpack.Marshal, Unmarshal: msgpack.Unmarshal}
+)
+
+// encodeTagged marshals v with the codec of CodecTag, prefixing the tag
+func (s *Db) encodeTagged(v interface{}) ([]byte, error) {
+	b, err := s.codecs[s.codecTag].Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	tagged := make([]byte, len(b)+1)
+	tagged[0] = s.codecTag
+	copy(tagged[1:], b)
+	return tagged, nil
+}
+
+// decodeTagged unmarshals data into dest with the codec of its tag
+//
+// Data starting with a byte that is not a tag of DbConfig.Codecs is a value written
+// before codec tagging was enabled, and is unmarshaled whole with the database's Unmarshal
+//
+func (s *Db) decodeTagged(data []byte, dest interface{}) error {
+	if len(data) == 0 {
+		return errors.New("zero length bytes has no codec tag")
+	}
+	codec, ok := s.codecs[data[0]]
+	if !ok {
+		return s.unmarshal(data, dest)
+	}
+	return codec.Unmarshal(data[1:], dest)
+}
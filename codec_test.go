@@ -0,0 +1,103 @@
+package lmdbstore
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// reopen closes env, if any, and opens config at the same path with dbs
+//
+// The caller closes the returned environment
+func reopen(t *testing.T, env *LmdbEnv, config LmdbEnvConfig, dbs ...DbConfig) *LmdbEnv {
+	t.Helper()
+	if env != nil {
+		env.Close()
+	}
+	config.Databases = dbs
+	env, err := NewLmdb(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return env
+}
+
+func TestCodecTagMigration(t *testing.T) {
+	jsonCodec := Codec{Marshal: json.Marshal, Unmarshal: json.Unmarshal}
+	codecs := map[byte]Codec{1: MsgpackArrayCodec, 2: jsonCodec}
+	config := DefaultLmdbConfig
+	config.OpenPath = t.TempDir()
+
+	// a value written before Codecs was enabled
+	env := reopen(t, nil, config, DbConfig{DbName: "a"})
+	defer func() { env.Close() }()
+	mustPut(t, env.GetDatabase("a"), "legacy", testRecord{ID: 0, Name: "legacy"})
+
+	env = reopen(t, env, config, DbConfig{DbName: "a", Codecs: codecs, CodecTag: 1})
+	mustPut(t, env.GetDatabase("a"), "a", testRecord{ID: 1, Name: "msgpack"})
+	env = reopen(t, env, config, DbConfig{DbName: "a", Codecs: codecs, CodecTag: 2})
+	db := env.GetDatabase("a")
+	mustPut(t, db, "b", testRecord{ID: 2, Name: "json"})
+
+	if got := mustGet(t, db, "b"); got != "\x02"+`{"ID":2,"Name":"json"}` {
+		t.Fatalf("b stored as %q", got)
+	}
+	if got := mustGet(t, db, "a"); got[0] != 1 {
+		t.Fatalf("a stored with tag %d", got[0])
+	}
+	for key, want := range map[string]testRecord{
+		"legacy": {ID: 0, Name: "legacy"},
+		"a":      {ID: 1, Name: "msgpack"},
+		"b":      {ID: 2, Name: "json"},
+	} {
+		var rec testRecord
+		if err := db.GetAndMarshal([]byte(key), &rec); err != nil || rec != want {
+			t.Fatalf("%s decoded %+v, %v", key, rec, err)
+		}
+	}
+}
+
+func TestCodecTagUnknown(t *testing.T) {
+	config := DefaultLmdbConfig
+	config.Databases = []DbConfig{{DbName: "a", Codecs: map[byte]Codec{1: MsgpackArrayCodec}, CodecTag: 2}}
+	config.OpenPath = t.TempDir()
+	if env, err := NewLmdb(config); err == nil {
+		env.Close()
+		t.Fatal("opened with a CodecTag missing from Codecs")
+	}
+}
+
+func TestMsgpackMapMode(t *testing.T) {
+	// testRecord with its fields in another order
+	type reordered struct {
+		Name string
+		ID   int
+	}
+	env := newTestEnv(t, DbConfig{DbName: "array"}, DbConfig{DbName: "map", MsgpackMapMode: true},
+		DbConfig{DbName: "json", MsgpackMapMode: true, Marshal: json.Marshal, Unmarshal: json.Unmarshal})
+	for _, name := range []string{"array", "map"} {
+		mustPut(t, env.GetDatabase(name), "rec", testRecord{ID: 1, Name: "one"})
+	}
+
+	var m map[string]interface{}
+	if err := env.GetDatabase("map").GetAndMarshal([]byte("rec"), &m); err != nil || m["Name"] != "one" {
+		t.Fatalf("map mode into a map = %v, %v", m, err)
+	}
+	var r reordered
+	if err := env.GetDatabase("map").GetAndMarshal([]byte("rec"), &r); err != nil || r != (reordered{Name: "one", ID: 1}) {
+		t.Fatalf("map mode into reordered fields = %+v, %v", r, err)
+	}
+	m = nil
+	if err := env.GetDatabase("array").GetAndMarshal([]byte("rec"), &m); err == nil {
+		t.Fatalf("array mode decoded into the map %v", m)
+	}
+	r = reordered{}
+	if err := env.GetDatabase("array").GetAndMarshal([]byte("rec"), &r); err == nil && r == (reordered{Name: "one", ID: 1}) {
+		t.Fatal("array mode matched reordered fields by name")
+	}
+
+	// Marshal and Unmarshal take precedence over MsgpackMapMode
+	mustPut(t, env.GetDatabase("json"), "rec", testRecord{ID: 2, Name: "two"})
+	if got := mustGet(t, env.GetDatabase("json"), "rec"); got != `{"ID":2,"Name":"two"}` {
+		t.Fatalf("json database stored %q", got)
+	}
+}
@@ -0,0 +1,126 @@
+package lmdbstore
+
+import (
+	"bytes"
+
+	"github.com/bmatsuo/lmdb-go/lmdb"
+)
+
+// DiffAgainst compares the database with other, walking both in key order
+//
+// added are the keys only in this database, removed the keys only in other,
+// and changed the keys in both with differing stored bytes. Expired keys are skipped.
+// Each database is read from a single View, other may belong to another LmdbEnv
+//
+// The returned keys are copied for safe use outside the lmdb.TxnOp
+//
+func (s *Db) DiffAgainst(other *Db) (added, removed, changed [][]byte, err error) {
+	err = s.lmdbEnv.View(func(txn *lmdb.Txn) error {
+		return other.lmdbEnv.View(func(otherTxn *lmdb.Txn) error {
+			added, removed, changed = nil, nil, nil
+			cur, err := newDiffCursor(s, txn)
+			if err != nil {
+				return err
+			}
+			defer cur.close()
+			otherCur, err := newDiffCursor(other, otherTxn)
+			if err != nil {
+				return err
+			}
+			defer otherCur.close()
+			for cur.key != nil || otherCur.key != nil {
+				cmp := 0
+				switch {
+				case cur.key == nil:
+					cmp = 1
+				case otherCur.key == nil:
+					cmp = -1
+				default:
+					cmp = bytes.Compare(cur.key, otherCur.key)
+				}
+				switch {
+				case cmp < 0:
+					added = append(added, copyBytes(cur.key))
+					err = cur.next()
+				case cmp > 0:
+					removed = append(removed, copyBytes(otherCur.key))
+					err = otherCur.next()
+				default:
+					if !bytes.Equal(cur.value, otherCur.value) {
+						changed = append(changed, copyBytes(cur.key))
+					}
+					err = cur.next()
+					if err == nil {
+						err = otherCur.next()
+					}
+				}
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+	return added, removed, changed, err
+}
+
+// diffCursor steps through the unexpired entries of a database, key is nil once past the last entry
+type diffCursor struct {
+	db    *Db
+	txn   *lmdb.Txn
+	cur   *lmdb.Cursor
+	key   []byte
+	value []byte
+}
+
+func newDiffCursor(db *Db, txn *lmdb.Txn) (*diffCursor, error) {
+	cur, err := txn.OpenCursor(db.dbi)
+	if err != nil {
+		return nil, err
+	}
+	c := &diffCursor{db: db, txn: txn, cur: cur}
+	err = c.step(lmdb.First)
+	if err != nil {
+		cur.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *diffCursor) next() error {
+	return c.step(lmdb.Next)
+}
+
+// step moves the cursor with op, then forward past expired entries
+func (c *diffCursor) step(op uint) error {
+	for {
+		k, v, err := c.cur.Get(nil, nil, op)
+		if lmdb.IsNotFound(err) {
+			c.key, c.value = nil, nil
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		expired, err := c.db.expired(c.txn, k)
+		if err != nil {
+			return err
+		}
+		if !expired {
+			c.key, c.value = k, v
+			return nil
+		}
+		op = lmdb.Next
+	}
+}
+
+func (c *diffCursor) close() {
+	c.cur.Close()
+}
+
+// copyBytes returns a copy of b
+func copyBytes(b []byte) []byte {
+	c := make([]byte, len(b))
+	copy(c, b)
+	return c
+}
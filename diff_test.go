@@ -0,0 +1,50 @@
+package lmdbstore
+
+import (
+	"fmt"
+	"testing"
+)
+
+// keyStrings returns keys as strings
+func keyStrings(keys [][]byte) []string {
+	s := make([]string, len(keys))
+	for i, key := range keys {
+		s[i] = string(key)
+	}
+	return s
+}
+
+func TestDiffAgainst(t *testing.T) {
+	env := newTestEnv(t, DbConfig{DbName: "a"}, DbConfig{DbName: "b"}, DbConfig{DbName: "c"})
+	a, b, c := env.GetDatabase("a"), env.GetDatabase("b"), env.GetDatabase("c")
+	for key, value := range map[string]string{"both": "v", "changed": "old", "onlyA1": "v", "onlyA2": "v"} {
+		mustPut(t, a, key, []byte(value))
+	}
+	for key, value := range map[string]string{"both": "v", "changed": "new", "onlyB": "v", "zzz": "v"} {
+		mustPut(t, b, key, []byte(value))
+	}
+	added, removed, changed, err := a.DiffAgainst(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := fmt.Sprint(keyStrings(added), keyStrings(removed), keyStrings(changed))
+	if want := "[onlyA1 onlyA2] [onlyB zzz] [changed]"; got != want {
+		t.Fatalf("overlapping diff = %s, want %s", got, want)
+	}
+
+	// disjoint, and against a database in another environment
+	mustPut(t, c, "x", []byte("v"))
+	other := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	mustPut(t, other, "y", []byte("v"))
+	added, removed, changed, err = c.DiffAgainst(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(keyStrings(added), keyStrings(removed), keyStrings(changed)); got != "[x] [y] []" {
+		t.Fatalf("disjoint diff = %s", got)
+	}
+	added, removed, changed, err = a.DiffAgainst(a)
+	if err != nil || len(added)+len(removed)+len(changed) != 0 {
+		t.Fatalf("diff against itself = %q %q %q, %v", added, removed, changed, err)
+	}
+}
@@ -0,0 +1,113 @@
+package lmdbstore
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/bmatsuo/lmdb-go/lmdb"
+)
+
+// importBatchSize is the number of entries written per transaction when importing
+const importBatchSize = 1000
+
+// jsonEntry is a single entry of ExportJSON and ImportJSON,
+// []byte fields are encoded as base64 by encoding/json
+type jsonEntry struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// ExportJSON writes every entry of the database to w as a JSON array
+// of {"key":"<base64>","value":"<base64>"} objects in key order
+//
+// All entries are read from a single View, so the dump is a consistent snapshot
+//
+func (s *Db) ExportJSON(w io.Writer) error {
+	return s.lmdbEnv.View(func(txn *lmdb.Txn) error {
+		_, err := io.WriteString(w, "[")
+		if err != nil {
+			return err
+		}
+		first := true
+		err = s.walkRange(txn, nil, nil, func(key, value []byte) error {
+			b, err := json.Marshal(jsonEntry{Key: key, Value: value})
+			if err != nil {
+				return err
+			}
+			if !first {
+				_, err = io.WriteString(w, ",")
+				if err != nil {
+					return err
+				}
+			}
+			first = false
+			_, err = w.Write(b)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, "]")
+		return err
+	})
+}
+
+// ImportJSON reads a JSON array written by ExportJSON from r and puts every entry inside the database
+//
+// Entries are written in transactions of up to 1000 entries,
+// so a failure midway leaves the earlier batches written.
+// A repeated key is handled by DbConfig.OnDuplicateKey
+//
+func (s *Db) ImportJSON(r io.Reader) error {
+	dec := json.NewDecoder(r)
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return errors.New("json dump is not an array")
+	}
+	batch := make([]jsonEntry, 0, importBatchSize)
+	seen := make(map[string]struct{})
+	for dec.More() {
+		var entry jsonEntry
+		err = dec.Decode(&entry)
+		if err != nil {
+			return err
+		}
+		err = s.checkDuplicate(seen, entry.Key)
+		if err != nil {
+			return err
+		}
+		batch = append(batch, entry)
+		if len(batch) == importBatchSize {
+			err = s.putJSONEntries(batch)
+			if err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+	_, err = dec.Token()
+	if err != nil {
+		return err
+	}
+	return s.putJSONEntries(batch)
+}
+
+// putJSONEntries puts entries inside the database in a single transaction
+func (s *Db) putJSONEntries(entries []jsonEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	return s.update(func(txn *lmdb.Txn) error {
+		for _, entry := range entries {
+			err := s.put(txn, entry.Key, entry.Value, 0)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,53 @@
+package lmdbstore
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	env := newTestEnv(t, DbConfig{DbName: "src"}, DbConfig{DbName: "dst"})
+	src, dst := env.GetDatabase("src"), env.GetDatabase("dst")
+	// more entries than one import transaction
+	putNumbered(t, src, "key", importBatchSize+10)
+	mustPut(t, src, "binary", []byte{0, 0xff, '"'})
+
+	var buf bytes.Buffer
+	if err := src.ExportJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := dst.ImportJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	count, err := dst.CountWhere(nil, nil, func(key, value []byte) bool { return true })
+	if err != nil || count != importBatchSize+11 {
+		t.Fatalf("imported %d entries, %v, want %d", count, err, importBatchSize+11)
+	}
+	if got := mustGet(t, dst, "binary"); got != "\x00\xff\"" {
+		t.Fatalf("binary = %q", got)
+	}
+	if got := mustGet(t, dst, "key1005"); got != "1005" {
+		t.Fatalf("key1005 = %q", got)
+	}
+}
+
+func TestImportJSONHandWritten(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	doc := `[
+		{"key": "aGVsbG8=", "value": "d29ybGQ="},
+		{"key": "ZW1wdHk=", "value": ""}
+	]`
+	if err := db.ImportJSON(strings.NewReader(doc)); err != nil {
+		t.Fatal(err)
+	}
+	if got := mustGet(t, db, "hello"); got != "world" {
+		t.Fatalf("hello = %q", got)
+	}
+	if got := mustGet(t, db, "empty"); got != "" {
+		t.Fatalf("empty = %q", got)
+	}
+	if err := db.ImportJSON(strings.NewReader(`{"key": "aGVsbG8="}`)); err == nil {
+		t.Fatal("a JSON object was imported as a dump")
+	}
+}
@@ -0,0 +1,144 @@
+package lmdbstore
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/bmatsuo/lmdb-go/lmdb"
+)
+
+// EvictionPolicy selects which entry is evicted from a database bounded by DbConfig.MaxEntries
+type EvictionPolicy int
+
+const (
+	// EvictFIFO evicts the entry whose key was first written the longest ago,
+	// overwriting a key keeps its position
+	EvictFIFO EvictionPolicy = iota
+	// EvictLRU evicts the entry whose key was written or touched the longest ago.
+	// Reads run in read-only transactions and do not refresh recency, use Db.Touch for that
+	EvictLRU
+)
+
+// Touch marks key as recently used for a database bounded with EvictLRU
+//
+// Touch does nothing for other databases or keys that do not exist
+//
+// The call will block until the transaction is finished
+//
+func (s *Db) Touch(key []byte) error {
+	if s.maxEntries <= 0 || s.eviction != EvictLRU {
+		return nil
+	}
+	return s.update(func(txn *lmdb.Txn) error {
+		_, err := txn.Get(s.dbi, key)
+		if lmdb.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return s.trackWrite(txn, key)
+	})
+}
+
+// trackWrite records the write of key inside txn and evicts entries over the bound
+func (s *Db) trackWrite(txn *lmdb.Txn, key []byte) error {
+	if s.maxEntries <= 0 {
+		return nil
+	}
+	seq, err := txn.Get(s.orderIndexDbi, key)
+	switch {
+	case err == nil && s.eviction == EvictFIFO:
+		return nil
+	case err == nil:
+		err = txn.Del(s.orderDbi, seq, nil)
+		if err != nil {
+			return err
+		}
+	case !lmdb.IsNotFound(err):
+		return err
+	}
+	next, err := s.nextOrderSeq(txn)
+	if err != nil {
+		return err
+	}
+	err = txn.Put(s.orderDbi, next, key, 0)
+	if err != nil {
+		return err
+	}
+	err = txn.Put(s.orderIndexDbi, key, next, 0)
+	if err != nil {
+		return err
+	}
+	return s.evict(txn, key)
+}
+
+// nextOrderSeq returns the sequence key following the last tracked write
+func (s *Db) nextOrderSeq(txn *lmdb.Txn) ([]byte, error) {
+	next := make([]byte, 8)
+	cur, err := txn.OpenCursor(s.orderDbi)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close()
+	last, _, err := cur.Get(nil, nil, lmdb.Last)
+	if lmdb.IsNotFound(err) {
+		return next, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	binary.BigEndian.PutUint64(next, binary.BigEndian.Uint64(last)+1)
+	return next, nil
+}
+
+// evict deletes the oldest tracked entries while the database exceeds its bound
+//
+// written is never evicted, in case older entries were written before MaxEntries was set
+//
+func (s *Db) evict(txn *lmdb.Txn, written []byte) error {
+	stat, err := txn.Stat(s.dbi)
+	if err != nil {
+		return err
+	}
+	for n := stat.Entries; n > uint64(s.maxEntries); n-- {
+		cur, err := txn.OpenCursor(s.orderDbi)
+		if err != nil {
+			return err
+		}
+		_, k, err := cur.Get(nil, nil, lmdb.First)
+		cur.Close()
+		if lmdb.IsNotFound(err) || (err == nil && bytes.Equal(k, written)) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		key := make([]byte, len(k))
+		copy(key, k)
+		err = s.del(txn, key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// untrack removes key from the write order inside txn
+func (s *Db) untrack(txn *lmdb.Txn, key []byte) error {
+	if s.maxEntries <= 0 {
+		return nil
+	}
+	seq, err := txn.Get(s.orderIndexDbi, key)
+	if lmdb.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	err = txn.Del(s.orderDbi, seq, nil)
+	if err != nil {
+		return err
+	}
+	return txn.Del(s.orderIndexDbi, key, nil)
+}
@@ -0,0 +1,51 @@
+package lmdbstore
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestEvictFIFO(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "cache", MaxEntries: 3}).GetDatabase("cache")
+	for _, key := range []string{"a", "b", "c"} {
+		mustPut(t, db, key, []byte("v"))
+	}
+	// overwriting keeps the position of a
+	mustPut(t, db, "a", []byte("v2"))
+	mustPut(t, db, "d", []byte("v"))
+	if got := fmt.Sprint(keysOf(t, db)); got != "[b c d]" {
+		t.Fatalf("keys = %s, want a evicted first", got)
+	}
+	mustPut(t, db, "e", []byte("v"))
+	if got := fmt.Sprint(keysOf(t, db)); got != "[c d e]" {
+		t.Fatalf("keys = %s, want b evicted next", got)
+	}
+}
+
+func TestEvictLRU(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "cache", MaxEntries: 3, Eviction: EvictLRU}).GetDatabase("cache")
+	for _, key := range []string{"a", "b", "c"} {
+		mustPut(t, db, key, []byte("v"))
+	}
+	// rewriting a and touching b leaves c as the least recently used
+	mustPut(t, db, "a", []byte("v2"))
+	if err := db.Touch([]byte("b")); err != nil {
+		t.Fatal(err)
+	}
+	mustPut(t, db, "d", []byte("v"))
+	if got := fmt.Sprint(keysOf(t, db)); got != "[a b d]" {
+		t.Fatalf("keys = %s, want c evicted", got)
+	}
+	mustPut(t, db, "e", []byte("v"))
+	if got := fmt.Sprint(keysOf(t, db)); got != "[b d e]" {
+		t.Fatalf("keys = %s, want a evicted", got)
+	}
+	// a deleted key no longer counts towards the bound
+	if err := db.Del([]byte("b")); err != nil {
+		t.Fatal(err)
+	}
+	mustPut(t, db, "f", []byte("v"))
+	if got := fmt.Sprint(keysOf(t, db)); got != "[d e f]" {
+		t.Fatalf("keys = %s after a delete", got)
+	}
+}
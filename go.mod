@@ -1,6 +1,6 @@
 module github.com/benedictjohannes/lmdbstore
 
-go 1.16
+go 1.18
 
 require (
 	github.com/bmatsuo/lmdb-go v1.8.0
@@ -0,0 +1,344 @@
+package lmdbstore
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unsafe"
+
+	"github.com/bmatsuo/lmdb-go/lmdb"
+)
+
+// LastTxnID returns the ID of the last committed transaction in the environment
+//
+// The ID increases with every committed write transaction,
+// so it can be used by change-data-capture consumers to track progress
+//
+func (l *LmdbEnv) LastTxnID() (int64, error) {
+	info, err := l.LmdbEnv.Info()
+	if err != nil {
+		return 0, err
+	}
+	return info.LastTxnID, nil
+}
+
+// Verify walks every configured database inside a single View
+// and checks that the number of entries iterated matches the database statistics
+//
+// Every database is checked. The returned error is the failure of the first database
+// in name order, counting the databases that failed after it.
+// nil means every database is readable and consistent
+//
+func (l *LmdbEnv) Verify() error {
+	names := make([]string, 0, len(l.databases))
+	for name := range l.databases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var errs []error
+	err := l.LmdbEnv.View(func(txn *lmdb.Txn) error {
+		for _, name := range names {
+			err := l.databases[name].verify(txn)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("database %s: %w", name, err))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return firstError(errs)
+}
+
+// firstError returns the first of errs, noting how many more errors followed it
+//
+// The returned error wraps the first error, nil if errs is empty
+//
+func firstError(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+	return fmt.Errorf("%w (and %d more)", errs[0], len(errs)-1)
+}
+
+// verify walks the database inside txn and compares the count against its statistics
+func (s *Db) verify(txn *lmdb.Txn) error {
+	stat, err := txn.Stat(s.dbi)
+	if err != nil {
+		return err
+	}
+	cur, err := txn.OpenCursor(s.dbi)
+	if err != nil {
+		return err
+	}
+	defer cur.Close()
+	var count uint64
+	for _, _, err = cur.Get(nil, nil, lmdb.First); err == nil; _, _, err = cur.Get(nil, nil, lmdb.Next) {
+		count++
+	}
+	if !lmdb.IsNotFound(err) {
+		return err
+	}
+	if count != stat.Entries {
+		return fmt.Errorf("iterated %d entries but statistics report %d", count, stat.Entries)
+	}
+	return nil
+}
+
+// ReaderCheck clears stale entries from the reader lock table,
+// left behind by crashed reader processes
+//
+// Returns the number of entries cleared
+//
+func (l *LmdbEnv) ReaderCheck() (int, error) {
+	return l.LmdbEnv.ReaderCheck()
+}
+
+// ReaderList returns the lines of the reader lock table
+//
+// When readers are active, the first line describes the space delimited fields
+// of the following reader lines
+//
+func (l *LmdbEnv) ReaderList() ([]string, error) {
+	var lines []string
+	err := l.LmdbEnv.ReaderList(func(line string) error {
+		lines = append(lines, strings.TrimRight(line, "\n"))
+		return nil
+	})
+	return lines, err
+}
+
+// ActiveReaders returns the number of read transactions currently open on the environment,
+// by all processes, as listed in the reader lock table
+//
+// Compare it with LmdbEnvConfig.MaxReaders, reads fail with lmdb.ReadersFull once all slots are taken
+//
+func (l *LmdbEnv) ActiveReaders() (int, error) {
+	lines, err := l.ReaderList()
+	if err != nil {
+		return 0, err
+	}
+	if len(lines) == 0 {
+		return 0, nil
+	}
+	active := 0
+	// the first line is the header, or the message that there are no readers
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		// reserved slots without an open transaction show "-" as txnid
+		if len(fields) == 3 && fields[2] != "-" {
+			active++
+		}
+	}
+	return active, nil
+}
+
+// MapUsage returns the fraction of MapSize taken by the pages in use by all databases
+//
+// Pages freed by deletes are not counted, so usage drops after deletes
+// even though the data file does not shrink
+//
+func (l *LmdbEnv) MapUsage() (usage float64, err error) {
+	err = l.LmdbEnv.View(func(txn *lmdb.Txn) error {
+		usage, err = l.mapUsage(txn)
+		return err
+	})
+	return usage, err
+}
+
+// mapUsage returns MapUsage as seen from txn
+func (l *LmdbEnv) mapUsage(txn *lmdb.Txn) (float64, error) {
+	info, err := l.LmdbEnv.Info()
+	if err != nil {
+		return 0, err
+	}
+	pages, psize, err := l.pagesInUse(txn)
+	if err != nil {
+		return 0, err
+	}
+	return float64(pages*uint64(psize)) / float64(info.MapSize), nil
+}
+
+// pagesInUse returns the number of pages in use by all databases as seen from txn, and the page size
+func (l *LmdbEnv) pagesInUse(txn *lmdb.Txn) (pages uint64, psize uint, err error) {
+	rootDbi, err := txn.OpenRoot(0)
+	if err != nil {
+		return 0, 0, err
+	}
+	root, err := txn.Stat(rootDbi)
+	if err != nil {
+		return 0, 0, err
+	}
+	// 2 meta pages and the main database holding the names of the named databases
+	pages = 2 + root.BranchPages + root.LeafPages + root.OverflowPages
+	for _, db := range l.databases {
+		for _, dbi := range db.dbis() {
+			stat, err := txn.Stat(dbi)
+			if err != nil {
+				return 0, 0, err
+			}
+			pages += stat.BranchPages + stat.LeafPages + stat.OverflowPages
+		}
+	}
+	if l.changelog {
+		stat, err := txn.Stat(l.changelogDbi)
+		if err != nil {
+			return 0, 0, err
+		}
+		pages += stat.BranchPages + stat.LeafPages + stat.OverflowPages
+	}
+	return pages, root.PSize, nil
+}
+
+// PageStats returns the number of pages in use by all databases
+// and the number of free pages listed in the freelist
+//
+// Free pages are left behind by deletes and overwrites and are reused by later writes,
+// the data file does not shrink until it is compacted with CompactTo.
+// Multiply by the page size of LmdbEnv.Stat for bytes
+//
+func (l *LmdbEnv) PageStats() (used, free int64, err error) {
+	err = l.LmdbEnv.View(func(txn *lmdb.Txn) error {
+		pages, _, err := l.pagesInUse(txn)
+		if err != nil {
+			return err
+		}
+		used = int64(pages)
+		// the freelist is the internal database 0, readable only in read transactions
+		cur, err := txn.OpenCursor(0)
+		if err != nil {
+			return err
+		}
+		defer cur.Close()
+		free = 0
+		var v []byte
+		for _, v, err = cur.Get(nil, nil, lmdb.First); err == nil; _, v, err = cur.Get(nil, nil, lmdb.Next) {
+			free += freelistPages(v)
+		}
+		if lmdb.IsNotFound(err) {
+			return nil
+		}
+		return err
+	})
+	return used, free, err
+}
+
+// freelistPages returns the number of pages in the freelist record v,
+// an array of native size_t page numbers prefixed with its length
+func freelistPages(v []byte) int64 {
+	var n uintptr
+	copy((*[unsafe.Sizeof(n)]byte)(unsafe.Pointer(&n))[:], v)
+	return int64(n)
+}
+
+// checkMapUsage returns ErrMapNearlyFull if map usage inside txn exceeds LmdbEnvConfig.MapFullThreshold
+func (l *LmdbEnv) checkMapUsage(txn *lmdb.Txn) error {
+	if l.mapFullThreshold <= 0 {
+		return nil
+	}
+	usage, err := l.mapUsage(txn)
+	if err != nil {
+		return err
+	}
+	if usage > l.mapFullThreshold {
+		return ErrMapNearlyFull
+	}
+	return nil
+}
+
+// writeOverhead is the estimated bytes of page and node headers of a single write
+const writeOverhead = 32
+
+// mapSpace is the map space left to the write transaction txn, as estimated by checkMapSpace
+type mapSpace struct {
+	// kept referenced so a later transaction cannot be allocated at the same address
+	txn     *lmdb.Txn
+	mapSize int64
+	psize   int64
+	free    int64
+	// free was counted from the pages in use instead of the pages never touched
+	counted bool
+}
+
+// checkMapSpace returns ErrInsufficientSpace if a write of size bytes clearly cannot fit
+// in the pages of the map not in use inside txn
+//
+// The estimate is the pages holding size bytes plus one leaf page.
+// The pages never touched are read once per transaction,
+// and the pages in use are only counted once the writes of txn do not fit in them.
+// Every accepted write is subtracted from the space left to txn
+//
+func (l *LmdbEnv) checkMapSpace(txn *lmdb.Txn, size int) error {
+	if !l.mapSpaceCheck {
+		return nil
+	}
+	l.mapSpaceMu.Lock()
+	defer l.mapSpaceMu.Unlock()
+	space := &l.mapSpace
+	if space.txn != txn {
+		info, err := l.LmdbEnv.Info()
+		if err != nil {
+			return err
+		}
+		stat, err := l.LmdbEnv.Stat()
+		if err != nil {
+			return err
+		}
+		psize := int64(stat.PSize)
+		*space = mapSpace{
+			txn:     txn,
+			mapSize: info.MapSize,
+			psize:   psize,
+			free:    info.MapSize - (info.LastPNO+1)*psize,
+		}
+	}
+	need := ((int64(size)+writeOverhead+space.psize-1)/space.psize + 1) * space.psize
+	if need > space.free && !space.counted {
+		pages, _, err := l.pagesInUse(txn)
+		if err != nil {
+			return err
+		}
+		space.free = space.mapSize - int64(pages)*space.psize
+		space.counted = true
+	}
+	if need > space.free {
+		return ErrInsufficientSpace
+	}
+	space.free -= need
+	return nil
+}
+
+// DbSummary is the statistics of a single database returned by LmdbEnv.Summary
+type DbSummary struct {
+	Entries     uint64
+	DepthOfTree uint
+	// pages used by the database multiplied by the page size
+	ApproxBytes uint64
+}
+
+// Summary returns the statistics of every configured database, keyed by database name
+//
+// All statistics are read from a single View
+//
+func (l *LmdbEnv) Summary() (summary map[string]DbSummary, err error) {
+	err = l.LmdbEnv.View(func(txn *lmdb.Txn) error {
+		summary = make(map[string]DbSummary, len(l.databases))
+		for name, db := range l.databases {
+			stat, err := txn.Stat(db.dbi)
+			if err != nil {
+				return fmt.Errorf("database %s: %w", name, err)
+			}
+			summary[name] = DbSummary{
+				Entries:     stat.Entries,
+				DepthOfTree: stat.Depth,
+				ApproxBytes: (stat.BranchPages + stat.LeafPages + stat.OverflowPages) * uint64(stat.PSize),
+			}
+		}
+		return nil
+	})
+	return summary, err
+}
@@ -0,0 +1,285 @@
+package lmdbstore
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bmatsuo/lmdb-go/lmdb"
+)
+
+func TestLastTxnIDIncreases(t *testing.T) {
+	env := newTestEnv(t, DbConfig{DbName: "a"})
+	db := env.GetDatabase("a")
+	before, err := env.LastTxnID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustPut(t, db, "k", []byte("v"))
+	after, err := env.LastTxnID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after <= before {
+		t.Fatalf("LastTxnID %d after a write, was %d", after, before)
+	}
+}
+
+func TestVerifyHealthy(t *testing.T) {
+	env := newTestEnv(t, DbConfig{DbName: "a"}, DbConfig{DbName: "b", TTL: true})
+	for i := 0; i < 100; i++ {
+		mustPut(t, env.GetDatabase("a"), string(rune('a'+i%26))+string(rune(i)), []byte("v"))
+	}
+	mustPut(t, env.GetDatabase("b"), "k", []byte("v"))
+	if err := env.Verify(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFirstError(t *testing.T) {
+	first, second := errors.New("first"), errors.New("second")
+	if err := firstError(nil); err != nil {
+		t.Fatalf("no errors: %v", err)
+	}
+	if err := firstError([]error{first}); err != first {
+		t.Fatalf("one error: %v", err)
+	}
+	err := firstError([]error{first, second, second})
+	if !errors.Is(err, first) || errors.Is(err, second) || err.Error() != "first (and 2 more)" {
+		t.Fatalf("three errors: %v", err)
+	}
+}
+
+func TestReaderCheck(t *testing.T) {
+	env := newTestEnv(t, DbConfig{DbName: "a"})
+	mustPut(t, env.GetDatabase("a"), "k", []byte("v"))
+	cleared, err := env.ReaderCheck()
+	if err != nil || cleared != 0 {
+		t.Fatalf("cleared %d, %v on a clean environment", cleared, err)
+	}
+	lines, err := env.ReaderList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range lines {
+		if strings.HasSuffix(line, "\n") {
+			t.Fatalf("line %q keeps its newline", line)
+		}
+	}
+}
+
+func TestMapFullThreshold(t *testing.T) {
+	config := DefaultLmdbConfig
+	config.Databases = []DbConfig{{DbName: "a"}}
+	config.MapSize = 4 << 20
+	config.MapFullThreshold = 0.5
+	db := newTestEnvConfig(t, config).GetDatabase("a")
+	value := make([]byte, 16<<10)
+	written := 0
+	for ; ; written++ {
+		err := db.Put([]byte(fmt.Sprintf("%04d", written)), value)
+		if err == ErrMapNearlyFull {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if written > 1000 {
+			t.Fatal("writes never crossed the threshold")
+		}
+	}
+	usage, err := db.env.MapUsage()
+	if err != nil || usage <= 0.5 {
+		t.Fatalf("rejected at usage %v, %v", usage, err)
+	}
+	// deletes are allowed past the threshold and bring usage back under it
+	for i := 0; i < written/2; i++ {
+		if err := db.Del([]byte(fmt.Sprintf("%04d", i))); err != nil {
+			t.Fatalf("delete past the threshold: %v", err)
+		}
+	}
+	if err := db.Put([]byte("after"), value); err != nil {
+		t.Fatalf("write after deletes: %v", err)
+	}
+}
+
+func TestSummary(t *testing.T) {
+	env := newTestEnv(t, DbConfig{DbName: "a"}, DbConfig{DbName: "b"}, DbConfig{DbName: "empty"})
+	putNumbered(t, env.GetDatabase("a"), "key", 10)
+	putNumbered(t, env.GetDatabase("b"), "key", 3)
+	summary, err := env.Summary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summary) != 3 {
+		t.Fatalf("summary of %d databases, want 3", len(summary))
+	}
+	for name, want := range map[string]uint64{"a": 10, "b": 3, "empty": 0} {
+		s := summary[name]
+		if s.Entries != want {
+			t.Fatalf("%s: %d entries, want %d", name, s.Entries, want)
+		}
+		if (want > 0) != (s.DepthOfTree > 0 && s.ApproxBytes > 0) {
+			t.Fatalf("%s: depth %d, %d bytes for %d entries", name, s.DepthOfTree, s.ApproxBytes, want)
+		}
+	}
+}
+
+func TestInsufficientSpace(t *testing.T) {
+	config := DefaultLmdbConfig
+	config.Databases = []DbConfig{{DbName: "a"}}
+	config.MapSize = 1 << 20
+	config.CheckMapSpace = true
+	db := newTestEnvConfig(t, config).GetDatabase("a")
+	// leave the tiny map nearly full
+	if err := db.Put([]byte("fill"), make([]byte, 700<<10)); err != nil {
+		t.Fatal(err)
+	}
+	large := make([]byte, 400<<10)
+	if err := db.Put([]byte("large"), large); err != ErrInsufficientSpace {
+		t.Fatalf("Put: %v, want ErrInsufficientSpace", err)
+	}
+	err := db.PutReserve([]byte("large"), len(large), func(buf []byte) error {
+		t.Fatal("fill called for a write that cannot fit")
+		return nil
+	})
+	if err != ErrInsufficientSpace {
+		t.Fatalf("PutReserve: %v, want ErrInsufficientSpace", err)
+	}
+	err = db.UpsertMany([]Entry{
+		{Key: []byte("small"), Value: []byte("v")},
+		{Key: []byte("large"), Value: large},
+	}, nil)
+	if err != ErrInsufficientSpace {
+		t.Fatalf("UpsertMany: %v, want ErrInsufficientSpace", err)
+	}
+	if _, err := db.Get([]byte("small")); err != ErrNotFound {
+		t.Fatalf("rejected batch wrote its first entry: %v", err)
+	}
+	// each entry fits on its own, the writes of the transaction are counted together
+	half := make([]byte, 200<<10)
+	err = db.UpsertMany([]Entry{
+		{Key: []byte("half1"), Value: half},
+		{Key: []byte("half2"), Value: half},
+	}, nil)
+	if err != ErrInsufficientSpace {
+		t.Fatalf("UpsertMany of entries fitting one at a time: %v, want ErrInsufficientSpace", err)
+	}
+	if err := db.Put([]byte("half1"), half); err != nil {
+		t.Fatalf("single entry of the rejected batch: %v", err)
+	}
+	if err := db.Del([]byte("half1")); err != nil {
+		t.Fatal(err)
+	}
+	// small writes still fit
+	if err := db.Put([]byte("small"), []byte("v")); err != nil {
+		t.Fatalf("small write: %v", err)
+	}
+}
+
+func TestInsufficientSpaceDisabled(t *testing.T) {
+	config := DefaultLmdbConfig
+	config.Databases = []DbConfig{{DbName: "a"}}
+	config.MapSize = 1 << 20
+	db := newTestEnvConfig(t, config).GetDatabase("a")
+	if err := db.Put([]byte("fill"), make([]byte, 700<<10)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put([]byte("large"), make([]byte, 400<<10)); !lmdb.IsMapFull(err) {
+		t.Fatalf("Put without CheckMapSpace: %v, want lmdb.MapFull", err)
+	}
+}
+
+func TestActiveReaders(t *testing.T) {
+	env := newTestEnv(t, DbConfig{DbName: "a"})
+	db := env.GetDatabase("a")
+	mustPut(t, db, "k", []byte("v"))
+	if n, err := env.ActiveReaders(); err != nil || n != 0 {
+		t.Fatalf("idle ActiveReaders = %d, %v, want 0", n, err)
+	}
+
+	// hold all but one reader slot of the default MaxReaders open at once
+	holders := DefaultLmdbConfig.MaxReaders - 1
+	var opened, release sync.WaitGroup
+	opened.Add(holders)
+	release.Add(1)
+	errs := make(chan error, holders)
+	for i := 0; i < holders; i++ {
+		go func() {
+			errs <- env.View(func(tx *ReadTx) error {
+				_, err := tx.Get(db, []byte("k"))
+				opened.Done()
+				release.Wait()
+				return err
+			})
+		}()
+	}
+	opened.Wait()
+	if n, err := env.ActiveReaders(); err != nil || n != holders {
+		t.Fatalf("ActiveReaders = %d, %v, want %d", n, err, holders)
+	}
+	release.Done()
+	for i := 0; i < holders; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("concurrent read: %v", err)
+		}
+	}
+
+	// many more goroutines than slots doing short reads
+	var wg sync.WaitGroup
+	failed := make(chan error, 1)
+	for i := 0; i < 64; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if _, err := db.Get([]byte("k")); err != nil {
+					select {
+					case failed <- err:
+					default:
+					}
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	select {
+	case err := <-failed:
+		t.Fatalf("concurrent Get: %v", err)
+	default:
+	}
+}
+
+func TestPageStats(t *testing.T) {
+	env := newTestEnv(t, DbConfig{DbName: "a"})
+	db := env.GetDatabase("a")
+	value := make([]byte, 8<<10)
+	err := env.Transaction(func(tx *Tx) error {
+		for i := 0; i < 200; i++ {
+			if err := tx.Put(db, []byte(fmt.Sprintf("%04d", i)), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	usedBefore, freeBefore, err := env.PageStats()
+	if err != nil || usedBefore < 200 {
+		t.Fatalf("PageStats after writing = %d used, %v", usedBefore, err)
+	}
+	if _, err := db.DelPrefix([]byte("0")); err != nil {
+		t.Fatal(err)
+	}
+	used, free, err := env.PageStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if used >= usedBefore || free < freeBefore+200 {
+		t.Fatalf("after deleting: %d used, %d free, was %d used, %d free", used, free, usedBefore, freeBefore)
+	}
+}
@@ -0,0 +1,524 @@
+package lmdbstore
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+
+	"github.com/bmatsuo/lmdb-go/lmdb"
+)
+
+// KV is a copied key and value pair
+type KV struct {
+	Key   []byte
+	Value []byte
+}
+
+// newKV copies key and value into a KV
+func newKV(key, value []byte) KV {
+	kv := KV{Key: make([]byte, len(key)), Value: make([]byte, len(value))}
+	copy(kv.Key, key)
+	copy(kv.Value, value)
+	return kv
+}
+
+// ErrStopIteration can be returned by iteration callbacks to stop iterating without an error
+var ErrStopIteration = errors.New("stop iteration")
+
+// walkRange calls fn for every entry with start <= key < end inside txn, in key order
+//
+// Empty start begins at the first key, nil end continues to the last key.
+// Expired keys are skipped.
+// fn returning ErrStopIteration ends the walk without an error.
+// The slices passed to fn are only valid until fn returns
+//
+func (s *Db) walkRange(txn *lmdb.Txn, start, end []byte, fn func(key, value []byte) error) error {
+	return s.walkRangeRaw(txn, start, end, func(key, value []byte) error {
+		expired, err := s.expired(txn, key)
+		if err != nil || expired {
+			return err
+		}
+		return fn(key, value)
+	})
+}
+
+// walkRangeRaw is walkRange including expired keys
+func (s *Db) walkRangeRaw(txn *lmdb.Txn, start, end []byte, fn func(key, value []byte) error) error {
+	cur, err := txn.OpenCursor(s.dbi)
+	if err != nil {
+		return err
+	}
+	defer cur.Close()
+	var k, v []byte
+	if len(start) == 0 {
+		k, v, err = cur.Get(nil, nil, lmdb.First)
+	} else {
+		k, v, err = cur.Get(start, nil, lmdb.SetRange)
+	}
+	for ; err == nil; k, v, err = cur.Get(nil, nil, lmdb.Next) {
+		if end != nil && bytes.Compare(k, end) >= 0 {
+			return nil
+		}
+		err = fn(k, v)
+		if err == ErrStopIteration {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if lmdb.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// prefixEnd returns the smallest key greater than every key starting with prefix
+//
+// nil is returned when no such key exists (prefix is empty or all 0xff)
+//
+func prefixEnd(prefix []byte) []byte {
+	end := make([]byte, len(prefix))
+	copy(end, prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
+
+// CountWhere counts the entries with start <= key < end for which pred returns true
+//
+// Empty start begins at the first key, nil end continues to the last key
+//
+// The slices passed to pred are only valid until pred returns,
+// copy them to retain them
+//
+func (s *Db) CountWhere(start, end []byte, pred func(key, value []byte) bool) (count uint64, err error) {
+	err = s.lmdbEnv.View(func(txn *lmdb.Txn) error {
+		count = 0
+		return s.walkRange(txn, start, end, func(key, value []byte) error {
+			if pred(key, value) {
+				count++
+			}
+			return nil
+		})
+	})
+	return count, err
+}
+
+// FindFirst returns the first entry in key order for which pred returns true
+//
+// found is false when no entry matches. Every entry may be scanned,
+// so FindFirst is meant for small databases
+//
+// The returned key and value are copied for safe use outside the lmdb.TxnOp
+//
+func (s *Db) FindFirst(pred func(key, value []byte) bool) (key, value []byte, found bool, err error) {
+	err = s.lmdbEnv.View(func(txn *lmdb.Txn) error {
+		found = false
+		return s.walkRange(txn, nil, nil, func(k, v []byte) error {
+			if !pred(k, v) {
+				return nil
+			}
+			kv := newKV(k, v)
+			key, value, found = kv.Key, kv.Value, true
+			return ErrStopIteration
+		})
+	})
+	return key, value, found, err
+}
+
+// ErrEmptyPrefix is returned by DelPrefix for an empty prefix, use Drop to empty the database
+var ErrEmptyPrefix = errors.New("prefix is empty")
+
+// DelPrefix deletes every key starting with prefix in a single transaction
+//
+// Returns the number of live keys deleted.
+// Expired keys under prefix are removed as well but not counted.
+// An empty prefix returns ErrEmptyPrefix instead of deleting every key
+//
+// The call will block until the transaction is finished
+//
+func (s *Db) DelPrefix(prefix []byte) (deleted int, err error) {
+	if len(prefix) == 0 {
+		return 0, ErrEmptyPrefix
+	}
+	err = s.update(func(txn *lmdb.Txn) error {
+		deleted = 0
+		var keys [][]byte
+		err := s.walkRangeRaw(txn, prefix, prefixEnd(prefix), func(key, value []byte) error {
+			k := make([]byte, len(key))
+			copy(k, key)
+			keys = append(keys, k)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			expired, err := s.expired(txn, key)
+			if err != nil {
+				return err
+			}
+			err = s.del(txn, key)
+			if err != nil {
+				return err
+			}
+			if !expired {
+				deleted++
+			}
+		}
+		return nil
+	})
+	return deleted, err
+}
+
+// DeleteWhere deletes the entries with start <= key < end for which pred returns true,
+// in a single transaction
+//
+// Empty start begins at the first key, nil end continues to the last key.
+// Returns the number of keys deleted
+//
+// The slices passed to pred are only valid until pred returns
+//
+// The call will block until the transaction is finished
+//
+func (s *Db) DeleteWhere(start, end []byte, pred func(key, value []byte) bool) (deleted int, err error) {
+	err = s.update(func(txn *lmdb.Txn) error {
+		deleted = 0
+		var keys [][]byte
+		err := s.walkRange(txn, start, end, func(key, value []byte) error {
+			if pred(key, value) {
+				k := make([]byte, len(key))
+				copy(k, key)
+				keys = append(keys, k)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			err = s.del(txn, key)
+			if err != nil {
+				return err
+			}
+		}
+		deleted = len(keys)
+		return nil
+	})
+	return deleted, err
+}
+
+// Scan returns the entries with keys starting with prefix in key order,
+// skipping the first offset entries and returning up to limit entries
+//
+// limit <= 0 returns every entry after offset
+//
+// The returned entries are copied for safe use outside the lmdb.TxnOp
+//
+func (s *Db) Scan(prefix []byte, offset, limit int) (kvs []KV, err error) {
+	err = s.lmdbEnv.View(func(txn *lmdb.Txn) error {
+		kvs = nil
+		skipped := 0
+		return s.walkRange(txn, prefix, prefixEnd(prefix), func(key, value []byte) error {
+			if skipped < offset {
+				skipped++
+				return nil
+			}
+			kvs = append(kvs, newKV(key, value))
+			if limit > 0 && len(kvs) >= limit {
+				return ErrStopIteration
+			}
+			return nil
+		})
+	})
+	return kvs, err
+}
+
+// KeysWithPrefix returns the keys starting with prefix in key order
+//
+// Values are not copied, the returned keys are copied for safe use outside the lmdb.TxnOp
+//
+func (s *Db) KeysWithPrefix(prefix []byte) (keys [][]byte, err error) {
+	err = s.lmdbEnv.View(func(txn *lmdb.Txn) error {
+		keys = nil
+		return s.walkRange(txn, prefix, prefixEnd(prefix), func(key, value []byte) error {
+			k := make([]byte, len(key))
+			copy(k, key)
+			keys = append(keys, k)
+			return nil
+		})
+	})
+	return keys, err
+}
+
+// GetSortedBatch returns the entries at keys in key order, skipping absent keys
+//
+// The keys are sorted and fetched in a single forward pass of one cursor,
+// which is faster than independent lookups for many keys
+//
+// The returned entries are copied for safe use outside the lmdb.TxnOp
+//
+func (s *Db) GetSortedBatch(keys [][]byte) (kvs []KV, err error) {
+	sorted := make([][]byte, len(keys))
+	copy(sorted, keys)
+	sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i], sorted[j]) < 0 })
+	err = s.lmdbEnv.View(func(txn *lmdb.Txn) error {
+		// the entries are copied by newKV, so read them in place
+		txn.RawRead = true
+		kvs = nil
+		return s.cursorDo(txn, func(cur *lmdb.Cursor) error {
+			// the key the cursor is positioned at
+			var at []byte
+			positioned := false
+			for i, key := range sorted {
+				if i > 0 && bytes.Equal(key, sorted[i-1]) {
+					continue
+				}
+				// keys before the cursor position do not exist
+				if positioned && bytes.Compare(key, at) < 0 {
+					continue
+				}
+				k, v, err := cur.Get(key, nil, lmdb.SetRange)
+				if lmdb.IsNotFound(err) {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				at, positioned = k, true
+				if !bytes.Equal(k, key) {
+					continue
+				}
+				expired, err := s.expired(txn, k)
+				if err != nil {
+					return err
+				}
+				if !expired {
+					kvs = append(kvs, newKV(k, v))
+				}
+			}
+			return nil
+		})
+	})
+	return kvs, err
+}
+
+// ExistsPrefix reports whether any key starting with prefix exists inside the database
+//
+// The cursor is positioned at prefix and stops at the first key found
+//
+func (s *Db) ExistsPrefix(prefix []byte) (exists bool, err error) {
+	err = s.lmdbEnv.View(func(txn *lmdb.Txn) error {
+		exists = false
+		return s.walkRange(txn, prefix, prefixEnd(prefix), func(key, value []byte) error {
+			exists = true
+			return ErrStopIteration
+		})
+	})
+	return exists, err
+}
+
+// SeparatorAwareScan calls fn in key order for the key equal to prefix
+// and the keys starting with prefix followed by sep
+//
+// With sep ':', scanning "a" matches "a" and "a:1" but not "ab:1".
+// The slices passed to fn are only valid until fn returns, copy them to retain them.
+// Iteration stops at the first error returned by fn,
+// returning ErrStopIteration stops without an error
+//
+func (s *Db) SeparatorAwareScan(prefix []byte, sep byte, fn func(key, value []byte) error) error {
+	return s.lmdbEnv.View(func(txn *lmdb.Txn) error {
+		return s.walkRange(txn, prefix, prefixEnd(prefix), func(key, value []byte) error {
+			if len(key) > len(prefix) && key[len(prefix)] != sep {
+				return nil
+			}
+			return fn(key, value)
+		})
+	})
+}
+
+// ScanSuffix calls fn for every key ending with suffix inside a lmdb.ReverseKey database,
+// in the database's reverse key order
+//
+// Keys of a lmdb.ReverseKey database are compared from their last byte,
+// so keys sharing a suffix are adjacent and the scan starts at the first of them.
+// The slices passed to fn are only valid until fn returns, copy them to retain them.
+// Iteration stops at the first error returned by fn,
+// returning ErrStopIteration stops without an error
+//
+func (s *Db) ScanSuffix(suffix []byte, fn func(key, value []byte) error) error {
+	err := s.requireFlags(lmdb.ReverseKey, "ReverseKey")
+	if err != nil {
+		return err
+	}
+	return s.lmdbEnv.View(func(txn *lmdb.Txn) error {
+		return s.walkRange(txn, suffix, nil, func(key, value []byte) error {
+			if !bytes.HasSuffix(key, suffix) {
+				return ErrStopIteration
+			}
+			return fn(key, value)
+		})
+	})
+}
+
+// CursorDo opens a read cursor on the database inside a View and passes it to fn
+//
+// The cursor is closed after fn returns, and the slices it returns are only valid until then.
+// Expiry set by PutWithTTL is not applied to entries read through the cursor
+//
+func (s *Db) CursorDo(fn func(cur *lmdb.Cursor) error) error {
+	return s.lmdbEnv.View(func(txn *lmdb.Txn) error {
+		return s.cursorDo(txn, fn)
+	})
+}
+
+// UpdateCursorDo opens a write cursor on the database inside the updater goroutine and passes it to fn
+//
+// Writes done through the cursor bypass MaxValueSize and TTL bookkeeping,
+// and disable the bloom filter of DbConfig.BloomFilter until rebuilt with RebuildBloomFilter.
+// They are not recorded by LmdbEnvConfig.Changelog.
+// If fn returns an error, the transaction is aborted
+//
+// The call will block until the transaction is finished
+//
+func (s *Db) UpdateCursorDo(fn func(cur *lmdb.Cursor) error) error {
+	return s.update(func(txn *lmdb.Txn) error {
+		s.invalidateBloomFilter()
+		return s.cursorDo(txn, fn)
+	})
+}
+
+// cursorDo opens a cursor on the database inside txn for the duration of fn
+func (s *Db) cursorDo(txn *lmdb.Txn, fn func(cur *lmdb.Cursor) error) error {
+	cur, err := txn.OpenCursor(s.dbi)
+	if err != nil {
+		return err
+	}
+	defer cur.Close()
+	return fn(cur)
+}
+
+// ForEach calls fn in key order for every entry with start <= key < end
+//
+// Empty start begins at the first key, nil end continues to the last key.
+// Iteration stops at the first error returned by fn,
+// returning ErrStopIteration stops without an error
+//
+// The slices passed to fn are only valid until fn returns
+//
+func (s *Db) ForEach(start, end []byte, fn func(key, value []byte) error) error {
+	return s.lmdbEnv.View(func(txn *lmdb.Txn) error {
+		return s.walkRange(txn, start, end, fn)
+	})
+}
+
+// IterateFrom calls fn for every entry with key strictly greater than after, in key order
+//
+// after does not need to exist, iteration then starts at the next greater key.
+// nil after iterates from the first key.
+// Iteration stops at the first error returned by fn,
+// returning ErrStopIteration stops without an error
+//
+// The slices passed to fn are only valid until fn returns
+//
+func (s *Db) IterateFrom(after []byte, fn func(key, value []byte) error) error {
+	return s.lmdbEnv.View(func(txn *lmdb.Txn) error {
+		return s.walkRange(txn, after, nil, func(key, value []byte) error {
+			if after != nil && bytes.Equal(key, after) {
+				return nil
+			}
+			return fn(key, value)
+		})
+	})
+}
+
+// IterateReverseFrom calls fn for every entry with key strictly less than before, in descending key order
+//
+// before does not need to exist, iteration then starts at the next smaller key.
+// nil before iterates from the last key.
+// Iteration stops at the first error returned by fn,
+// returning ErrStopIteration stops without an error
+//
+// The slices passed to fn are only valid until fn returns
+//
+func (s *Db) IterateReverseFrom(before []byte, fn func(key, value []byte) error) error {
+	return s.lmdbEnv.View(func(txn *lmdb.Txn) error {
+		cur, err := txn.OpenCursor(s.dbi)
+		if err != nil {
+			return err
+		}
+		defer cur.Close()
+		var k, v []byte
+		if before == nil {
+			k, v, err = cur.Get(nil, nil, lmdb.Last)
+		} else {
+			// positioned at the first key >= before, or past the end
+			_, _, err = cur.Get(before, nil, lmdb.SetRange)
+			if lmdb.IsNotFound(err) {
+				k, v, err = cur.Get(nil, nil, lmdb.Last)
+			} else if err == nil {
+				k, v, err = cur.Get(nil, nil, lmdb.Prev)
+			}
+		}
+		for ; err == nil; k, v, err = cur.Get(nil, nil, lmdb.Prev) {
+			expired, err := s.expired(txn, k)
+			if err != nil {
+				return err
+			}
+			if expired {
+				continue
+			}
+			err = fn(k, v)
+			if err == ErrStopIteration {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if lmdb.IsNotFound(err) {
+			return nil
+		}
+		return err
+	})
+}
+
+// ForEachBatch calls fn with the entries of the database in key order,
+// in chunks of up to batchSize entries, inside a single View
+//
+// batchSize <= 0 defaults to 1000, the last chunk may be shorter.
+// Iteration stops at the first error returned by fn,
+// returning ErrStopIteration stops without an error
+//
+// The entries are copied, fn may retain them
+//
+func (s *Db) ForEachBatch(batchSize int, fn func(batch []KV) error) error {
+	if batchSize <= 0 {
+		batchSize = importBatchSize
+	}
+	return s.lmdbEnv.View(func(txn *lmdb.Txn) error {
+		batch := make([]KV, 0, batchSize)
+		err := s.walkRange(txn, nil, nil, func(key, value []byte) error {
+			batch = append(batch, newKV(key, value))
+			if len(batch) < batchSize {
+				return nil
+			}
+			err := fn(batch)
+			batch = make([]KV, 0, batchSize)
+			return err
+		})
+		if err != nil || len(batch) == 0 {
+			return err
+		}
+		err = fn(batch)
+		if err == ErrStopIteration {
+			return nil
+		}
+		return err
+	})
+}
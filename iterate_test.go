@@ -0,0 +1,538 @@
+package lmdbstore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/bmatsuo/lmdb-go/lmdb"
+)
+
+// putNumbered puts n entries with keys key000, key001... and values of their index
+func putNumbered(t testing.TB, db *Db, prefix string, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		mustPut(t, db, fmt.Sprintf("%s%03d", prefix, i), []byte(fmt.Sprint(i)))
+	}
+}
+
+func TestCountWhere(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	putNumbered(t, db, "key", 20)
+	even := func(key, value []byte) bool {
+		return (value[len(value)-1]-'0')%2 == 0
+	}
+	count, err := db.CountWhere(nil, nil, even)
+	if err != nil || count != 10 {
+		t.Fatalf("even entries: %d, %v, want 10", count, err)
+	}
+	count, err = db.CountWhere([]byte("key005"), []byte("key010"), even)
+	if err != nil || count != 2 {
+		t.Fatalf("even entries in [key005, key010): %d, %v, want 2", count, err)
+	}
+	count, err = db.CountWhere(nil, nil, func(key, value []byte) bool { return false })
+	if err != nil || count != 0 {
+		t.Fatalf("always false: %d, %v, want 0", count, err)
+	}
+}
+
+// keysOf returns the keys of the database in order
+func keysOf(t testing.TB, db *Db) []string {
+	t.Helper()
+	var keys []string
+	err := db.lmdbEnv.View(func(txn *lmdb.Txn) error {
+		return db.walkRange(txn, nil, nil, func(key, value []byte) error {
+			keys = append(keys, string(key))
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func TestDelPrefix(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	for _, key := range []string{"us", "user", "user/1", "user/2", "users/1", "usf", "\xff\xff", "\xff\xff\x00"} {
+		mustPut(t, db, key, []byte("v"))
+	}
+	deleted, err := db.DelPrefix([]byte("user/"))
+	if err != nil || deleted != 2 {
+		t.Fatalf("deleted %d, %v, want 2", deleted, err)
+	}
+	deleted, err = db.DelPrefix([]byte("\xff\xff"))
+	if err != nil || deleted != 2 {
+		t.Fatalf("deleted %d under a prefix without an upper bound, %v, want 2", deleted, err)
+	}
+	want := "[us user users/1 usf]"
+	if got := fmt.Sprint(keysOf(t, db)); got != want {
+		t.Fatalf("keys = %s, want %s", got, want)
+	}
+	if _, err := db.DelPrefix(nil); err != ErrEmptyPrefix {
+		t.Fatalf("empty prefix: %v, want ErrEmptyPrefix", err)
+	}
+	if got := fmt.Sprint(keysOf(t, db)); got != want {
+		t.Fatalf("keys = %s after an empty prefix, want %s", got, want)
+	}
+}
+
+func TestDelPrefixSkipsExpired(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "cache", TTL: true}).GetDatabase("cache")
+	err := db.PutTTLBatch([]TTLEntry{
+		{Key: []byte("user/1"), Value: []byte("v"), TTL: time.Hour},
+		{Key: []byte("user/2"), Value: []byte("v"), TTL: 20 * time.Millisecond},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustPut(t, db, "user/3", []byte("v"))
+	time.Sleep(50 * time.Millisecond)
+	deleted, err := db.DelPrefix([]byte("user/"))
+	if err != nil || deleted != 2 {
+		t.Fatalf("deleted %d, %v, want the 2 live keys", deleted, err)
+	}
+	// the expired entry is removed together with its expiry
+	err = db.lmdbEnv.View(func(txn *lmdb.Txn) error {
+		for _, dbi := range []lmdb.DBI{db.dbi, db.ttlDbi} {
+			stat, err := txn.Stat(dbi)
+			if err != nil {
+				return err
+			}
+			if stat.Entries != 0 {
+				t.Errorf("%d entries left in dbi %d", stat.Entries, dbi)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeleteWhere(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	putNumbered(t, db, "key", 10)
+	even := func(key, value []byte) bool {
+		return (key[len(key)-1]-'0')%2 == 0
+	}
+	deleted, err := db.DeleteWhere(nil, nil, even)
+	if err != nil || deleted != 5 {
+		t.Fatalf("deleted %d, %v, want 5", deleted, err)
+	}
+	want := "[key001 key003 key005 key007 key009]"
+	if got := fmt.Sprint(keysOf(t, db)); got != want {
+		t.Fatalf("keys = %s, want %s", got, want)
+	}
+	// consecutive matches are all deleted, none skipped by the cursor
+	deleted, err = db.DeleteWhere([]byte("key003"), []byte("key009"), func(key, value []byte) bool { return true })
+	if err != nil || deleted != 3 {
+		t.Fatalf("deleted %d in [key003, key009), %v, want 3", deleted, err)
+	}
+	if got := fmt.Sprint(keysOf(t, db)); got != "[key001 key009]" {
+		t.Fatalf("keys = %s", got)
+	}
+}
+
+// kvKeys returns the keys of kvs
+func kvKeys(kvs []KV) []string {
+	keys := make([]string, len(kvs))
+	for i, kv := range kvs {
+		keys[i] = string(kv.Key)
+	}
+	return keys
+}
+
+func TestScan(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	putNumbered(t, db, "a/", 5)
+	putNumbered(t, db, "b/", 5)
+	for _, test := range []struct {
+		prefix        string
+		offset, limit int
+		want          string
+	}{
+		{"a/", 0, 0, "[a/000 a/001 a/002 a/003 a/004]"},
+		{"a/", 1, 2, "[a/001 a/002]"},
+		{"a/", 3, 10, "[a/003 a/004]"},
+		{"a/", 5, 1, "[]"},
+		{"a/", 50, 1, "[]"},
+		{"b/", 4, 0, "[b/004]"},
+		{"", 4, 2, "[a/004 b/000]"},
+		{"c/", 0, 0, "[]"},
+	} {
+		kvs, err := db.Scan([]byte(test.prefix), test.offset, test.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(kvKeys(kvs)); got != test.want {
+			t.Fatalf("Scan(%q, %d, %d) = %s, want %s", test.prefix, test.offset, test.limit, got, test.want)
+		}
+	}
+	kvs, err := db.Scan([]byte("b/002"), 0, 0)
+	if err != nil || len(kvs) != 1 || string(kvs[0].Value) != "2" {
+		t.Fatalf("values: %v, %v", kvs, err)
+	}
+}
+
+func TestCursorDo(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	putNumbered(t, db, "key", 10)
+	// walk [key003, key006] backwards
+	var keys []string
+	err := db.CursorDo(func(cur *lmdb.Cursor) error {
+		k, _, err := cur.Get([]byte("key006"), nil, lmdb.SetRange)
+		for ; err == nil && bytes.Compare(k, []byte("key003")) >= 0; k, _, err = cur.Get(nil, nil, lmdb.Prev) {
+			keys = append(keys, string(k))
+		}
+		if lmdb.IsNotFound(err) {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(keys); got != "[key006 key005 key004 key003]" {
+		t.Fatalf("keys = %s", got)
+	}
+
+	err = db.UpdateCursorDo(func(cur *lmdb.Cursor) error {
+		_, _, err := cur.Get([]byte("key008"), nil, lmdb.Set)
+		if err != nil {
+			return err
+		}
+		err = cur.Del(0)
+		if err != nil {
+			return err
+		}
+		return cur.Put([]byte("key100"), []byte("100"), 0)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Get([]byte("key008")); err != ErrNotFound {
+		t.Fatalf("key008: %v, want ErrNotFound", err)
+	}
+	if got := mustGet(t, db, "key100"); got != "100" {
+		t.Fatalf("key100 = %q", got)
+	}
+}
+
+func TestIterateFrom(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	putNumbered(t, db, "key", 6)
+	collect := func(after []byte, limit int) string {
+		var keys []string
+		err := db.IterateFrom(after, func(key, value []byte) error {
+			if len(keys) == limit {
+				return ErrStopIteration
+			}
+			keys = append(keys, string(key))
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fmt.Sprint(keys)
+	}
+	if got := collect([]byte("key002"), -1); got != "[key003 key004 key005]" {
+		t.Fatalf("after key002: %s", got)
+	}
+	// a missing key resumes at the next greater key
+	if got := collect([]byte("key0025"), -1); got != "[key003 key004 key005]" {
+		t.Fatalf("after key0025: %s", got)
+	}
+	if got := collect(nil, 2); got != "[key000 key001]" {
+		t.Fatalf("from the start, stopped after 2: %s", got)
+	}
+	if got := collect([]byte("key005"), -1); got != "[]" {
+		t.Fatalf("after the last key: %s", got)
+	}
+}
+
+func TestFindFirst(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	if _, _, found, err := db.FindFirst(func(key, value []byte) bool { return true }); err != nil || found {
+		t.Fatalf("empty database: found %v, %v", found, err)
+	}
+	putNumbered(t, db, "key", 10)
+	key, value, found, err := db.FindFirst(func(key, value []byte) bool { return value[0] > '6' })
+	if err != nil || !found || string(key) != "key007" || string(value) != "7" {
+		t.Fatalf("FindFirst = %q, %q, %v, %v", key, value, found, err)
+	}
+	key, value, found, err = db.FindFirst(func(key, value []byte) bool { return false })
+	if err != nil || found || key != nil || value != nil {
+		t.Fatalf("never matching: %q, %q, %v, %v", key, value, found, err)
+	}
+	if _, _, found, err := db.ReadOnly().FindFirst(func(key, value []byte) bool { return true }); err != nil || !found {
+		t.Fatalf("ReadOnlyDb.FindFirst: found %v, %v", found, err)
+	}
+}
+
+func TestSeparatorAwareScan(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	for _, key := range []string{"a:1", "ab:1", "a:2", "a", "a:2:x", "b:1"} {
+		mustPut(t, db, key, []byte("v"))
+	}
+	scan := func(scan func(prefix []byte, sep byte, fn func(key, value []byte) error) error) string {
+		var keys []string
+		err := scan([]byte("a"), ':', func(key, value []byte) error {
+			keys = append(keys, string(key))
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fmt.Sprint(keys)
+	}
+	want := "[a a:1 a:2 a:2:x]"
+	if got := scan(db.SeparatorAwareScan); got != want {
+		t.Fatalf("keys = %s, want %s", got, want)
+	}
+	if got := scan(db.ReadOnly().SeparatorAwareScan); got != want {
+		t.Fatalf("ReadOnlyDb keys = %s, want %s", got, want)
+	}
+}
+
+func TestKeysWithPrefix(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	for _, key := range []string{"user", "user/1", "user/1/post/1", "user/2", "users", "x"} {
+		mustPut(t, db, key, []byte("v"))
+	}
+	for _, c := range []struct{ prefix, want string }{
+		{"user/", "[user/1 user/1/post/1 user/2]"},
+		{"user/1/", "[user/1/post/1]"},
+		{"user", "[user user/1 user/1/post/1 user/2 users]"},
+		{"none", "[]"},
+	} {
+		keys, err := db.KeysWithPrefix([]byte(c.prefix))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, key := range keys {
+			got = append(got, string(key))
+		}
+		if fmt.Sprint(got) != c.want {
+			t.Fatalf("KeysWithPrefix(%q) = %v, want %s", c.prefix, got, c.want)
+		}
+	}
+	// the keys are copies, not slices of the memory map
+	keys, err := db.ReadOnly().KeysWithPrefix([]byte("x"))
+	if err != nil || len(keys) != 1 {
+		t.Fatalf("ReadOnlyDb KeysWithPrefix = %q, %v", keys, err)
+	}
+	keys[0][0] = 'y'
+	if got := mustGet(t, db, "x"); got != "v" {
+		t.Fatalf("x = %q after modifying the returned key", got)
+	}
+}
+
+func TestScanSuffix(t *testing.T) {
+	env := newTestEnv(t, DbConfig{DbName: "hosts", Flags: lmdb.ReverseKey}, DbConfig{DbName: "plain"})
+	db := env.GetDatabase("hosts")
+	for _, key := range []string{"b.example.com", "example.org", "a.example.com", "xexample.com", "com", "a.example.co"} {
+		mustPut(t, db, key, []byte("v"))
+	}
+	scan := func(scan func(suffix []byte, fn func(key, value []byte) error) error, suffix string) string {
+		var keys []string
+		err := scan([]byte(suffix), func(key, value []byte) error {
+			keys = append(keys, string(key))
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fmt.Sprint(keys)
+	}
+	if got := scan(db.ScanSuffix, ".example.com"); got != "[a.example.com b.example.com]" {
+		t.Fatalf("ScanSuffix(.example.com) = %s", got)
+	}
+	if got := scan(db.ReadOnly().ScanSuffix, ".org"); got != "[example.org]" {
+		t.Fatalf("ReadOnlyDb ScanSuffix(.org) = %s", got)
+	}
+	if got := scan(db.ScanSuffix, ".net"); got != "[]" {
+		t.Fatalf("ScanSuffix(.net) = %s", got)
+	}
+	err := env.GetDatabase("plain").ScanSuffix([]byte("com"), func(key, value []byte) error { return nil })
+	if err == nil {
+		t.Fatal("ScanSuffix succeeded on a database without ReverseKey")
+	}
+}
+
+func TestGetSortedBatch(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	putNumbered(t, db, "k", 10)
+	keys := [][]byte{
+		[]byte("k007"), []byte("a"), []byte("k002"), []byte("k0025"),
+		[]byte("k007"), []byte("k000"), []byte("z"), []byte("k009"),
+	}
+	kvs, err := db.GetSortedBatch(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(kvKeys(kvs)); got != "[k000 k002 k007 k009]" {
+		t.Fatalf("keys = %s", got)
+	}
+	for _, kv := range kvs {
+		if want := string(kv.Key[len(kv.Key)-1:]); string(kv.Value) != want {
+			t.Fatalf("value at %s = %q, want %q", kv.Key, kv.Value, want)
+		}
+	}
+	if string(keys[0]) != "k007" || string(keys[1]) != "a" {
+		t.Fatal("GetSortedBatch reordered the keys passed in")
+	}
+	kvs, err = db.ReadOnly().GetSortedBatch([][]byte{[]byte("x"), []byte("y")})
+	if err != nil || len(kvs) != 0 {
+		t.Fatalf("absent keys = %v, %v", kvKeys(kvs), err)
+	}
+}
+
+// benchmarkBatchKeys writes 10000 entries and returns every tenth key in random order
+func benchmarkBatchKeys(b *testing.B) (*Db, [][]byte) {
+	db := newTestEnv(b, DbConfig{DbName: "a"}).GetDatabase("a")
+	err := db.env.Transaction(func(tx *Tx) error {
+		for i := 0; i < 10000; i++ {
+			if err := tx.Put(db, []byte(fmt.Sprintf("k%05d", i)), fmt.Sprint(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	var keys [][]byte
+	for _, i := range rand.New(rand.NewSource(1)).Perm(1000) {
+		keys = append(keys, []byte(fmt.Sprintf("k%05d", i*10)))
+	}
+	return db, keys
+}
+
+func BenchmarkGetSortedBatch(b *testing.B) {
+	db, keys := benchmarkBatchKeys(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := db.GetSortedBatch(keys); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGetMany(b *testing.B) {
+	db, keys := benchmarkBatchKeys(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := GetMany[string](db, keys); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestExistsPrefix(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	for _, key := range []string{"apple", "banana/1", "cherry"} {
+		mustPut(t, db, key, []byte("v"))
+	}
+	for prefix, want := range map[string]bool{
+		"banana/": true,
+		"ban":     true,
+		"apple":   true,
+		"apples":  false,
+		"b/":      false,
+		"d":       false,
+		"":        true,
+	} {
+		exists, err := db.ExistsPrefix([]byte(prefix))
+		if err != nil || exists != want {
+			t.Fatalf("ExistsPrefix(%q) = %v, %v, want %v", prefix, exists, err, want)
+		}
+	}
+	if exists, err := db.ReadOnly().ExistsPrefix([]byte("cher")); err != nil || !exists {
+		t.Fatalf("ReadOnlyDb ExistsPrefix = %v, %v", exists, err)
+	}
+}
+
+func TestForEachBatch(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	putNumbered(t, db, "k", 25)
+	var sizes []int
+	var batches [][]KV
+	err := db.ForEachBatch(10, func(batch []KV) error {
+		sizes = append(sizes, len(batch))
+		batches = append(batches, batch)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(sizes); got != "[10 10 5]" {
+		t.Fatalf("batch sizes = %s, want [10 10 5]", got)
+	}
+	// batches are retained safely and cover every entry in order
+	var keys []string
+	for _, batch := range batches {
+		keys = append(keys, kvKeys(batch)...)
+	}
+	if fmt.Sprint(keys) != fmt.Sprint(keysOf(t, db)) {
+		t.Fatalf("batched keys = %v", keys)
+	}
+
+	calls := 0
+	err = db.ReadOnly().ForEachBatch(10, func(batch []KV) error {
+		calls++
+		return ErrStopIteration
+	})
+	if err != nil || calls != 1 {
+		t.Fatalf("ErrStopIteration: %d calls, %v", calls, err)
+	}
+	errFailed := errors.New("failed")
+	if err := db.ForEachBatch(30, func(batch []KV) error { return errFailed }); err != errFailed {
+		t.Fatalf("failing fn on the final batch: %v", err)
+	}
+}
+
+func TestIterateReverseFrom(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	putNumbered(t, db, "key", 6)
+	collect := func(iterate func(before []byte, fn func(key, value []byte) error) error, before []byte, limit int) string {
+		var keys []string
+		err := iterate(before, func(key, value []byte) error {
+			if len(keys) == limit {
+				return ErrStopIteration
+			}
+			keys = append(keys, string(key))
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fmt.Sprint(keys)
+	}
+	if got := collect(db.IterateReverseFrom, []byte("key003"), -1); got != "[key002 key001 key000]" {
+		t.Fatalf("before key003: %s", got)
+	}
+	// a missing key resumes at the next smaller key
+	if got := collect(db.IterateReverseFrom, []byte("key0035"), -1); got != "[key003 key002 key001 key000]" {
+		t.Fatalf("before key0035: %s", got)
+	}
+	// paging newest first, resuming from the last key of the previous page
+	if got := collect(db.ReadOnly().IterateReverseFrom, nil, 2); got != "[key005 key004]" {
+		t.Fatalf("first page: %s", got)
+	}
+	if got := collect(db.IterateReverseFrom, []byte("key004"), 2); got != "[key003 key002]" {
+		t.Fatalf("second page: %s", got)
+	}
+	if got := collect(db.IterateReverseFrom, []byte("key000"), -1); got != "[]" {
+		t.Fatalf("before the first key: %s", got)
+	}
+	if got := collect(db.IterateReverseFrom, []byte("zzz"), 1); got != "[key005]" {
+		t.Fatalf("before a key past the last: %s", got)
+	}
+}
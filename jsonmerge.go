@@ -0,0 +1,70 @@
+package lmdbstore
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/bmatsuo/lmdb-go/lmdb"
+)
+
+// MergeJSON merges the fields of patch into the JSON object stored at key, in a single transaction
+//
+// The merge is shallow: every field of patch replaces the field of the stored object.
+// If the key does not exist, patch is stored as a new object
+//
+// Values are stored as JSON bytes, bypassing the database's Marshal
+//
+// The call will block until the transaction is finished
+//
+func (s *Db) MergeJSON(key []byte, patch map[string]interface{}) error {
+	return s.mergeJSON(key, patch, false)
+}
+
+// MergeJSONDeep is MergeJSON merging nested objects recursively
+//
+// A field holding an object in both the stored document and patch is merged field by field,
+// any other field of patch replaces the stored field
+//
+func (s *Db) MergeJSONDeep(key []byte, patch map[string]interface{}) error {
+	return s.mergeJSON(key, patch, true)
+}
+
+func (s *Db) mergeJSON(key []byte, patch map[string]interface{}, deep bool) error {
+	return s.update(func(txn *lmdb.Txn) error {
+		doc := map[string]interface{}{}
+		b, err := s.get(txn, key)
+		if err != nil && err != ErrNotFound {
+			return err
+		}
+		if err == nil {
+			err = json.Unmarshal(b, &doc)
+			if err != nil {
+				return err
+			}
+			if doc == nil {
+				return errors.New("stored json value is not an object")
+			}
+		}
+		mergeJSONObjects(doc, patch, deep)
+		b, err = json.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		return s.put(txn, key, b, 0)
+	})
+}
+
+// mergeJSONObjects merges the fields of patch into dst
+func mergeJSONObjects(dst, patch map[string]interface{}, deep bool) {
+	for k, v := range patch {
+		if deep {
+			dstObj, dstOk := dst[k].(map[string]interface{})
+			patchObj, patchOk := v.(map[string]interface{})
+			if dstOk && patchOk {
+				mergeJSONObjects(dstObj, patchObj, deep)
+				continue
+			}
+		}
+		dst[k] = v
+	}
+}
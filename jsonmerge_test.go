@@ -0,0 +1,34 @@
+package lmdbstore
+
+import (
+	"testing"
+)
+
+func TestMergeJSON(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "docs"}).GetDatabase("docs")
+	// creates the document when absent
+	if err := db.MergeJSON([]byte("user"), map[string]interface{}{"name": "alice", "address": map[string]interface{}{"city": "Oslo", "zip": "0150"}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := mustGet(t, db, "user"); got != `{"address":{"city":"Oslo","zip":"0150"},"name":"alice"}` {
+		t.Fatalf("created %s", got)
+	}
+	// adds and overwrites fields, replacing nested objects as a whole
+	if err := db.MergeJSON([]byte("user"), map[string]interface{}{"name": "bob", "age": 30, "address": map[string]interface{}{"city": "Bergen"}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := mustGet(t, db, "user"); got != `{"address":{"city":"Bergen"},"age":30,"name":"bob"}` {
+		t.Fatalf("shallow merge %s", got)
+	}
+	if err := db.MergeJSONDeep([]byte("user"), map[string]interface{}{"address": map[string]interface{}{"zip": "5003"}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := mustGet(t, db, "user"); got != `{"address":{"city":"Bergen","zip":"5003"},"age":30,"name":"bob"}` {
+		t.Fatalf("deep merge %s", got)
+	}
+
+	mustPut(t, db, "array", []byte(`[1,2]`))
+	if err := db.MergeJSON([]byte("array"), map[string]interface{}{"a": 1}); err == nil {
+		t.Fatal("merged into a JSON array")
+	}
+}
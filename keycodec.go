@@ -0,0 +1,147 @@
+package lmdbstore
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNoKeyCodec is returned by the typed key methods of a database without DbConfig.KeyCodec
+var ErrNoKeyCodec = errors.New("database has no key codec")
+
+// KeyCodec encodes typed keys to bytes and decodes them back
+//
+// Implementations should produce keys whose byte order matches the order of the typed keys,
+// so ranges over encoded keys follow the typed order
+//
+type KeyCodec interface {
+	EncodeKey(key interface{}) ([]byte, error)
+	DecodeKey(b []byte, dest interface{}) error
+}
+
+// StringKeyCodec encodes string keys as their bytes
+type StringKeyCodec struct{}
+
+// EncodeKey encodes a string key
+func (StringKeyCodec) EncodeKey(key interface{}) ([]byte, error) {
+	str, ok := key.(string)
+	if !ok {
+		return nil, fmt.Errorf("string key codec cannot encode %T", key)
+	}
+	return []byte(str), nil
+}
+
+// DecodeKey decodes b into dest, which must be a *string
+func (StringKeyCodec) DecodeKey(b []byte, dest interface{}) error {
+	str, ok := dest.(*string)
+	if !ok {
+		return fmt.Errorf("string key codec cannot decode into %T", dest)
+	}
+	*str = string(b)
+	return nil
+}
+
+// Uint64KeyCodec encodes uint64 keys as 8 big-endian bytes, sorting in numeric order
+type Uint64KeyCodec struct{}
+
+// EncodeKey encodes a uint64 key
+func (Uint64KeyCodec) EncodeKey(key interface{}) ([]byte, error) {
+	n, ok := key.(uint64)
+	if !ok {
+		return nil, fmt.Errorf("uint64 key codec cannot encode %T", key)
+	}
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, n)
+	return b, nil
+}
+
+// DecodeKey decodes b into dest, which must be a *uint64
+func (Uint64KeyCodec) DecodeKey(b []byte, dest interface{}) error {
+	n, ok := dest.(*uint64)
+	if !ok {
+		return fmt.Errorf("uint64 key codec cannot decode into %T", dest)
+	}
+	if len(b) != 8 {
+		return fmt.Errorf("uint64 key must be 8 bytes, got %d", len(b))
+	}
+	*n = binary.BigEndian.Uint64(b)
+	return nil
+}
+
+// TimeKeyCodec encodes time.Time keys with TimeKey, sorting in chronological order
+type TimeKeyCodec struct{}
+
+// EncodeKey encodes a time.Time key
+func (TimeKeyCodec) EncodeKey(key interface{}) ([]byte, error) {
+	t, ok := key.(time.Time)
+	if !ok {
+		return nil, fmt.Errorf("time key codec cannot encode %T", key)
+	}
+	return TimeKey(t), nil
+}
+
+// DecodeKey decodes b into dest, which must be a *time.Time
+func (TimeKeyCodec) DecodeKey(b []byte, dest interface{}) error {
+	t, ok := dest.(*time.Time)
+	if !ok {
+		return fmt.Errorf("time key codec cannot decode into %T", dest)
+	}
+	if len(b) != 8 {
+		return fmt.Errorf("time key must be 8 bytes, got %d", len(b))
+	}
+	*t = KeyTime(b)
+	return nil
+}
+
+// EncodeKey encodes key with the DbConfig.KeyCodec of the database
+func (s *Db) EncodeKey(key interface{}) ([]byte, error) {
+	if s.keyCodec == nil {
+		return nil, ErrNoKeyCodec
+	}
+	return s.keyCodec.EncodeKey(key)
+}
+
+// DecodeKey decodes b into dest with the DbConfig.KeyCodec of the database
+func (s *Db) DecodeKey(b []byte, dest interface{}) error {
+	if s.keyCodec == nil {
+		return ErrNoKeyCodec
+	}
+	return s.keyCodec.DecodeKey(b, dest)
+}
+
+// PutKey puts value inside the database at key encoded with DbConfig.KeyCodec
+//
+// The call will block until the transaction is finished
+//
+func (s *Db) PutKey(key interface{}, value interface{}) error {
+	b, err := s.EncodeKey(key)
+	if err != nil {
+		return err
+	}
+	return s.Put(b, value)
+}
+
+// GetKey marshals value at key encoded with DbConfig.KeyCodec into &dest
+//
+// If the key does not exist, ErrNotFound is returned
+//
+func (s *Db) GetKey(key interface{}, dest interface{}) error {
+	b, err := s.EncodeKey(key)
+	if err != nil {
+		return err
+	}
+	return s.GetAndMarshal(b, dest)
+}
+
+// DelKey deletes key encoded with DbConfig.KeyCodec from the database
+//
+// The call will block until the transaction is finished
+//
+func (s *Db) DelKey(key interface{}) error {
+	b, err := s.EncodeKey(key)
+	if err != nil {
+		return err
+	}
+	return s.Del(b)
+}
@@ -0,0 +1,77 @@
+package lmdbstore
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// checkSortOrder encodes keys, which are in ascending order, and checks the encodings sort likewise
+func checkSortOrder(t *testing.T, codec KeyCodec, keys []interface{}) {
+	t.Helper()
+	var prev []byte
+	for i, key := range keys {
+		b, err := codec.EncodeKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i > 0 && bytes.Compare(prev, b) >= 0 {
+			t.Fatalf("%v encodes to %x, not after %v at %x", key, b, keys[i-1], prev)
+		}
+		prev = b
+	}
+}
+
+func TestUint64KeyCodecSortOrder(t *testing.T) {
+	checkSortOrder(t, Uint64KeyCodec{}, []interface{}{uint64(0), uint64(1), uint64(255), uint64(256), uint64(1 << 40), ^uint64(0)})
+	b, _ := Uint64KeyCodec{}.EncodeKey(uint64(1 << 40))
+	var n uint64
+	if err := (Uint64KeyCodec{}).DecodeKey(b, &n); err != nil || n != 1<<40 {
+		t.Fatalf("decoded %d, %v", n, err)
+	}
+	if _, err := (Uint64KeyCodec{}).EncodeKey(1); err == nil {
+		t.Fatal("encoded an int as a uint64 key")
+	}
+}
+
+func TestTimeKeyCodecSortOrder(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	checkSortOrder(t, TimeKeyCodec{}, []interface{}{
+		time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Unix(0, -1),
+		time.Unix(0, 0),
+		base,
+		base.Add(time.Nanosecond),
+		base.Add(time.Hour),
+	})
+	b, _ := TimeKeyCodec{}.EncodeKey(base)
+	var ts time.Time
+	if err := (TimeKeyCodec{}).DecodeKey(b, &ts); err != nil || !ts.Equal(base) {
+		t.Fatalf("decoded %v, %v", ts, err)
+	}
+}
+
+func TestTypedKeyMethods(t *testing.T) {
+	env := newTestEnv(t, DbConfig{DbName: "users", KeyCodec: StringKeyCodec{}}, DbConfig{DbName: "plain"})
+	db := env.GetDatabase("users")
+	if err := db.PutKey("alice", "v"); err != nil {
+		t.Fatal(err)
+	}
+	var name string
+	if err := db.DecodeKey([]byte("alice"), &name); err != nil || name != "alice" {
+		t.Fatalf("decoded %q, %v", name, err)
+	}
+	var v string
+	if err := db.GetKey("alice", &v); err != nil || v != "v" {
+		t.Fatalf("GetKey = %q, %v", v, err)
+	}
+	if err := db.DelKey("alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.GetKey("alice", &v); err != ErrNotFound {
+		t.Fatalf("GetKey after DelKey: %v, want ErrNotFound", err)
+	}
+	if err := env.GetDatabase("plain").PutKey("alice", []byte("v")); err != ErrNoKeyCodec {
+		t.Fatalf("err = %v, want ErrNoKeyCodec", err)
+	}
+}
@@ -0,0 +1,30 @@
+package lmdbstore
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// keyLockShards is the number of mutexes WithKeyLock spreads keys over
+const keyLockShards = 256
+
+// keyLocks is the sharded mutex map of WithKeyLock
+type keyLocks [keyLockShards]sync.Mutex
+
+// WithKeyLock calls fn while holding an advisory lock on key,
+// so callers of WithKeyLock with the same key run fn one at a time
+//
+// The lock is process-local: it does not guard against other processes using the environment,
+// nor against writes that do not go through WithKeyLock.
+// Keys are spread over a fixed number of mutexes, so unrelated keys may also wait on each other,
+// and WithKeyLock must not be nested or fn may deadlock.
+// fn runs outside of any transaction and may span several of them
+//
+func (s *Db) WithKeyLock(key []byte, fn func() error) error {
+	h := fnv.New32a()
+	h.Write(key)
+	mu := &s.keyLocks[h.Sum32()%keyLockShards]
+	mu.Lock()
+	defer mu.Unlock()
+	return fn()
+}
@@ -0,0 +1,58 @@
+package lmdbstore
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestWithKeyLock(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	mustPut(t, db, "counter", []byte("0"))
+	var inside, overlaps int32
+	var wg sync.WaitGroup
+	const workers = 50
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := db.WithKeyLock([]byte("counter"), func() error {
+				if atomic.AddInt32(&inside, 1) > 1 {
+					atomic.AddInt32(&overlaps, 1)
+				}
+				defer atomic.AddInt32(&inside, -1)
+				// read and write in separate transactions
+				b, err := db.Get([]byte("counter"))
+				if err != nil {
+					return err
+				}
+				n, err := strconv.Atoi(string(b))
+				if err != nil {
+					return err
+				}
+				return db.Put([]byte("counter"), []byte(strconv.Itoa(n+1)))
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if overlaps != 0 {
+		t.Fatalf("%d callers ran fn at the same time", overlaps)
+	}
+	if got := mustGet(t, db, "counter"); got != strconv.Itoa(workers) {
+		t.Fatalf("counter = %s, want %d", got, workers)
+	}
+
+	errFailed := errors.New("failed")
+	if err := db.WithKeyLock([]byte("counter"), func() error { return errFailed }); err != errFailed {
+		t.Fatalf("err = %v, want fn's error", err)
+	}
+	// the lock is released after fn fails
+	if err := db.WithKeyLock([]byte("counter"), func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,70 @@
+package lmdbstore
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// commitLatencyWindow is the number of recent write transactions CommitLatency reports on
+const commitLatencyWindow = 1024
+
+// LatencyStats summarises the durations of recent write transactions
+//
+// Count is the total number of write transactions since the environment was opened,
+// while Min, Max, P50 and P99 cover only the most recent ones
+//
+type LatencyStats struct {
+	Count uint64
+	Min   time.Duration
+	Max   time.Duration
+	P50   time.Duration
+	P99   time.Duration
+}
+
+// latencyWindow is a ring buffer of the most recent durations, safe for concurrent use
+type latencyWindow struct {
+	mu        sync.Mutex
+	durations []time.Duration
+	count     uint64
+}
+
+func newLatencyWindow(size int) *latencyWindow {
+	return &latencyWindow{durations: make([]time.Duration, 0, size)}
+}
+
+func (w *latencyWindow) record(d time.Duration) {
+	w.mu.Lock()
+	if len(w.durations) < cap(w.durations) {
+		w.durations = append(w.durations, d)
+	} else {
+		w.durations[w.count%uint64(cap(w.durations))] = d
+	}
+	w.count++
+	w.mu.Unlock()
+}
+
+func (w *latencyWindow) stats() LatencyStats {
+	w.mu.Lock()
+	sorted := append([]time.Duration(nil), w.durations...)
+	stats := LatencyStats{Count: w.count}
+	w.mu.Unlock()
+	if len(sorted) == 0 {
+		return stats
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	stats.Min = sorted[0]
+	stats.Max = sorted[len(sorted)-1]
+	stats.P50 = sorted[(len(sorted)-1)*50/100]
+	stats.P99 = sorted[(len(sorted)-1)*99/100]
+	return stats
+}
+
+// CommitLatency returns the latency of the last 1024 write transactions, including their commit
+//
+// The durations exclude the time spent waiting for the updater goroutine,
+// see WriteQueueDepth for that
+//
+func (e *LmdbEnv) CommitLatency() LatencyStats {
+	return e.commitLatency.stats()
+}
@@ -0,0 +1,38 @@
+package lmdbstore
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCommitLatency(t *testing.T) {
+	env := newTestEnv(t, DbConfig{DbName: "a"})
+	if stats := env.CommitLatency(); stats.Count != 0 || stats.Max != 0 {
+		t.Fatalf("stats %+v before any write", stats)
+	}
+	db := env.GetDatabase("a")
+	var last uint64
+	for i := 0; i < 20; i++ {
+		mustPut(t, db, "k", []byte{byte(i)})
+		stats := env.CommitLatency()
+		if stats.Count <= last {
+			t.Fatalf("Count %d after write %d, was %d", stats.Count, i, last)
+		}
+		last = stats.Count
+		if stats.Min <= 0 || stats.Min > stats.P50 || stats.P50 > stats.P99 || stats.P99 > stats.Max {
+			t.Fatalf("stats %+v out of order", stats)
+		}
+	}
+}
+
+func TestLatencyWindow(t *testing.T) {
+	w := newLatencyWindow(4)
+	for _, d := range []time.Duration{100, 1, 2, 3, 4} {
+		w.record(d)
+	}
+	// the oldest duration has left the window
+	stats := w.stats()
+	if stats != (LatencyStats{Count: 5, Min: 1, Max: 4, P50: 2, P99: 3}) {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
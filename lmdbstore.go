@@ -1,15 +1,66 @@
 package lmdbstore
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
 	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/bmatsuo/lmdb-go/lmdb"
 	"github.com/shamaton/msgpack/v2"
 )
 
+// ErrNotFound is returned when the requested key does not exist in the database
+//
+// ErrNotFound is the *lmdb.OpError that Get returned for missing keys before ErrNotFound existed,
+// so lmdb.IsNotFound(err) and type assertions to *lmdb.OpError keep working.
+// Its Op is "mdb_get" for every method, including Del
+var ErrNotFound error = &lmdb.OpError{Op: "mdb_get", Errno: lmdb.NotFound}
+
+// ErrValueTooLarge is returned when writing a value larger than LmdbEnvConfig.MaxValueSize
+var ErrValueTooLarge = errors.New("value exceeds the configured maximum value size")
+
+// ErrNilValue is returned when writing a nil value or a nil pointer
+//
+// To store an empty value, write an empty []byte instead
+var ErrNilValue = errors.New("value is nil")
+
+// ErrOpenTimeout is returned by NewLmdb when opening takes longer than LmdbEnvConfig.OpenTimeout
+//
+// The underlying open may still be in progress, the environment is closed when it finishes
+var ErrOpenTimeout = errors.New("timeout opening lmdb environment")
+
+// ErrMapNearlyFull is returned by writes once map usage exceeds LmdbEnvConfig.MapFullThreshold
+var ErrMapNearlyFull = errors.New("map usage exceeds the configured threshold")
+
+// ErrClosed is returned by blocking calls like WaitForKey when the LmdbEnv is closed
+var ErrClosed = errors.New("lmdb environment is closed")
+
+// ErrInsufficientSpace is returned with LmdbEnvConfig.CheckMapSpace by writes that clearly cannot fit
+// in the remaining map space, before the write is attempted instead of failing with lmdb.MapFull
+var ErrInsufficientSpace = errors.New("insufficient map space for write")
+
+// ErrPanicInTxn is wrapped by the error returned when a write transaction panics
+//
+// The panic is recovered inside the updater goroutine, the transaction is aborted
+// and the updater goroutine keeps serving later transactions
+var ErrPanicInTxn = errors.New("panic in transaction")
+
+// notFound translates lmdb's not found errors into ErrNotFound
+func notFound(err error) error {
+	if lmdb.IsNotFound(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
 // LmdbEnvConfig is configuration for LmdbEnv
 //
 // There should be minimum 1 Databases []DbConfig entry
@@ -23,7 +74,64 @@ type LmdbEnvConfig struct {
 	OpenFlag   uint
 	OpenFSMode fs.FileMode
 	MapSize    int64
+	// maximum number of read transactions open at once across all processes.
+	// Every concurrent read takes a slot, reads beyond it fail with lmdb.ReadersFull,
+	// so size it for the number of goroutines reading concurrently. See ActiveReaders
 	MaxReaders int
+	// optional, creates OpenPath and its missing parents before opening,
+	// or the parent of OpenPath with lmdb.NoSubdir
+	CreateDirs bool
+	// optional, permissions of directories created with CreateDirs, 0 defaults to 0755
+	DirMode fs.FileMode
+	// optional, adds lmdb.NoReadahead to OpenFlag.
+	// Improves random access reads on databases larger than RAM
+	DisableReadahead bool
+	// optional, NewLmdb fails with ErrOpenTimeout if opening the environment
+	// takes longer than OpenTimeout, like when waiting for a lock on NFS.
+	// 0 waits indefinitely
+	OpenTimeout time.Duration
+	// optional, takes an advisory lock file next to the environment on open,
+	// failing NewLmdb with ErrAlreadyLocked while another LmdbEnv holds it.
+	// Guards workflows assuming a single writing process, the lock is released on Close
+	SingleWriter bool
+	// optional, ignores OpenPath and opens the environment with lmdb.NoSync in a new temporary
+	// directory, on tmpfs at /dev/shm when available, which is removed on Close.
+	// Meant for tests and other ephemeral databases
+	MemoryOnly bool
+	// optional, flushes the environment to disk every SyncInterval.
+	// Bounds data loss on crash when opened with lmdb.NoSync or lmdb.MapAsync.
+	// 0 disables periodic flushing
+	SyncInterval time.Duration
+	// optional, runs write transactions directly on the calling goroutine
+	// instead of the updater goroutine, which is then not spawned.
+	// Avoids the channel hop for single goroutine tools,
+	// concurrent writers then wait on LMDB's write lock instead of the channel
+	SyncWrites bool
+	// optional, directory Close writes a compacted copy of the environment into
+	// before closing it, replacing the copy written by a previous Close.
+	// The original is left in place, so disk usage
+	// transiently doubles. With lmdb.NoSubdir it is the data file of the copy instead.
+	// Errors are reported by LmdbEnv.CloseErr
+	CompactOnClose string
+	// optional, once the pages in use exceed this fraction of MapSize (e.g. 0.95),
+	// writes fail with ErrMapNearlyFull until deletes bring usage back under it.
+	// Deletes are always allowed. 0 disables the check
+	MapFullThreshold float64
+	// optional, writes that clearly cannot fit in the remaining map space
+	// fail with ErrInsufficientSpace before they are attempted.
+	// The remaining space is read once per write transaction
+	// and reduced by the estimated size of every write inside it
+	CheckMapSpace bool
+	// optional, writes of values larger than MaxValueSize bytes
+	// (after marshaling) fail with ErrValueTooLarge. 0 means unlimited
+	MaxValueSize int
+	// optional, records every Put and Del of all databases with its transaction ID
+	// in an internal changelog database, replayed by LmdbEnv.Changes.
+	// Emptying a database records an OpDrop.
+	// Writes done directly on lmdb.Txn, through Db.UpdateTxn, Db.UpdateCursorDo,
+	// Tx.Txn or Migration.Apply, are not recorded.
+	// The changelog grows until trimmed with LmdbEnv.TrimChanges
+	Changelog bool
 	// minimum 1 entry
 	Databases []DbConfig
 	// optional
@@ -32,11 +140,17 @@ type LmdbEnvConfig struct {
 	Unmarshal func(data []byte, v interface{}) error
 }
 
+// DefaultLmdbConfig is a starting configuration to copy and adjust
+//
+// MapSize defaults to 1 GiB, or 256 MiB on 32-bit platforms where the address space is limited.
+// MaxReaders defaults to twice the number of CPUs,
+// raise it for more goroutines reading concurrently
+//
 var DefaultLmdbConfig = LmdbEnvConfig{
 	OpenPath:   ".",
 	OpenFSMode: 0644,
-	MapSize:    1 << 30,
-	MaxReaders: 1,
+	MapSize:    defaultMapSize,
+	MaxReaders: runtime.NumCPU() * 2,
 	Databases:  []DbConfig{{DbName: "default"}},
 	Marshal:    msgpack.MarshalAsArray,
 	Unmarshal:  msgpack.UnmarshalAsArray,
@@ -49,11 +163,34 @@ var DefaultLmdbConfig = LmdbEnvConfig{
 // Do not create the struct directly
 //
 type LmdbEnv struct {
+	// number of write ops waiting for the updater goroutine, accessed atomically.
+	// Kept first for 64-bit alignment on 32-bit platforms
+	writeQueueDepth int64
 	// Direct access to *lmdb.Env
 	LmdbEnv          *lmdb.Env
+	maxValueSize     int
+	mapFullThreshold float64
+	mapSpaceCheck    bool
+	mapSpaceMu       sync.Mutex
+	mapSpace         mapSpace // guarded by mapSpaceMu
 	databases        map[string]*Db
+	aliases          map[string]*Db
 	updateWorkerChan chan *dbOp
 	quitChan         chan bool
+	closedChan       chan struct{}
+	closeOnce        sync.Once
+	closingChan      chan struct{} // closed when Close starts
+	closeMu          sync.RWMutex  // held for reading by the polls of blocked calls
+	updaterRunning   bool          // false with SyncWrites and no SyncInterval
+	syncWrites       bool
+	compactOnClose   string
+	closeErr         error
+	commitLatency    *latencyWindow
+	writerLock       *os.File // set with SingleWriter
+	tempDir          string   // set with MemoryOnly, removed on Close
+	writeBuf         []byte   // reused by DbConfig.MarshalAppend inside the updater goroutine
+	changelog        bool
+	changelogDbi     lmdb.DBI
 	marshal          func(v interface{}) ([]byte, error)
 	unmarshal        func(data []byte, v interface{}) error
 }
@@ -74,10 +211,35 @@ func (l *LmdbEnv) GetSingleDatabase() (*Db, error) {
 
 // GetDatabase returns a database with name dbName
 //
+// dbName can also be an alias registered with AliasDatabase
+//
 // Non-existing entries will return nil
 //
 func (l *LmdbEnv) GetDatabase(dbName string) *Db {
-	return l.databases[dbName]
+	if db, ok := l.databases[dbName]; ok {
+		return db
+	}
+	return l.aliases[dbName]
+}
+
+// AliasDatabase makes the database named existing also available as GetDatabase(alias)
+//
+// Both names return the same Db, operating on the same data.
+// Aliases are not counted as databases by GetSingleDatabase, Verify or Summary
+//
+// AliasDatabase must not be called concurrently with GetDatabase,
+// register aliases right after opening the environment
+//
+func (l *LmdbEnv) AliasDatabase(existing, alias string) error {
+	db := l.GetDatabase(existing)
+	if db == nil {
+		return fmt.Errorf("database %s does not exist", existing)
+	}
+	if l.GetDatabase(alias) != nil {
+		return fmt.Errorf("database %s already exists", alias)
+	}
+	l.aliases[alias] = db
+	return nil
 }
 
 type dbOp struct {
@@ -92,11 +254,39 @@ type dbOp struct {
 // Do not create Db struct directly
 //
 type Db struct {
+	name             string
 	dbi              lmdb.DBI
 	lmdbEnv          *lmdb.Env
-	updateWorkerChan chan *dbOp
+	env              *LmdbEnv
 	marshal          func(v interface{}) ([]byte, error)
 	unmarshal        func(data []byte, v interface{}) error
+	marshalWithKey   func(key []byte, v interface{}) ([]byte, error)
+	marshalAppend    func(dst []byte, v interface{}) ([]byte, error)
+	unmarshalWithKey func(key []byte, data []byte, v interface{}) error
+	keyCodec         KeyCodec
+	flags            uint
+	onDuplicateKey   DuplicateKeyPolicy
+	keyLocks         keyLocks
+	// set when DbConfig.TTL is enabled
+	ttl        bool
+	ttlDbi     lmdb.DBI
+	defaultTTL time.Duration
+	// set when DbConfig.BloomFilter is enabled
+	bloom *bloomFilter
+	// set when DbConfig.Codecs is enabled
+	codecs   map[byte]Codec
+	codecTag byte
+	// set when DbConfig.MaxEntries is enabled
+	maxEntries    int
+	eviction      EvictionPolicy
+	orderDbi      lmdb.DBI
+	orderIndexDbi lmdb.DBI
+	// set when DbConfig.Sequence is enabled
+	sequence bool
+	seqDbi   lmdb.DBI
+	// set when DbConfig.Audited is enabled
+	audited    bool
+	createdDbi lmdb.DBI
 }
 
 // DbConfig is configuration that will be created as entries in LmdbEnv.Databases
@@ -106,15 +296,124 @@ type Db struct {
 // Different Marshal and Unmarshal per database is possible,
 // but should never change for the lifetime of the database.
 //
+// MarshalWithKey and UnmarshalWithKey are optional and receive the key being written or read,
+// for codecs that encode differently based on the key.
+// When set, they are used instead of Marshal and Unmarshal.
+//
+// MarshalAppend is optional and must encode like Marshal, appending to dst.
+// Writes inside the updater goroutine then marshal into a reused buffer instead of allocating.
+// It is not used with MarshalWithKey or Codecs.
+//
+// KeyCodec is optional and enables the typed key methods PutKey, GetKey and DelKey.
+//
+// Flags are optional lmdb database flags like lmdb.DupSort,
+// lmdb.Create is always added.
+// Flags should never change for the lifetime of the database.
+//
+// TTL enables PutWithTTL and PutTTLBatch.
+// Expiry deadlines are kept in an internal sidecar database,
+// which takes one extra slot of the environment's databases.
+// DefaultTTL implies TTL, every write then expires after DefaultTTL
+// unless written by PutWithTTL or PutTTLBatch with their own TTL.
+//
+// MaxEntries bounds the number of entries, evicting entries chosen by Eviction
+// when a write of a new key exceeds the bound.
+// Write order is kept in two internal sidecar databases.
+//
+// Sequence enables Append, which writes values under an increasing uint64 key.
+// The counter is kept in an internal sidecar database and survives Drop,
+// TruncateAndReset drops the entries and resets the counter.
+//
+// OnDuplicateKey selects how PutTTLBatch, UpsertMany, Pipe.Exec, ImportJSON, StreamFrom and LoadFrom
+// handle a key repeated in one batch, the default DuplicateLastWins applies the entries in order.
+// Imports check the whole input, failing before the batch holding the repeat is written,
+// earlier batches stay written.
+//
+// Audited enables PutAudited and CreatedAt.
+// Creation timestamps are kept in an internal sidecar database,
+// deleting a key clears its timestamp so a later PutAudited records a new one.
+//
+// BloomFilter keeps an in-memory bloom filter of the keys, built by scanning the keys on open,
+// so lookups of most absent keys return ErrNotFound without opening a transaction.
+// A key the filter reports as possibly present falls through to a real lookup.
+// The filter is sized on open and false positives grow as keys are added after that.
+// Raw writes through Db.UpdateTxn, Db.UpdateCursorDo, LmdbEnv.Transaction or migrations
+// disable the filter until Db.RebuildBloomFilter is called.
+// Writes from other processes sharing the environment are not seen by the filter
+// and are not supported.
+//
+// Codecs enables codec tagging: marshaled values are prefixed with a one byte tag
+// identifying the codec that wrote them, and decoded with the codec of their tag.
+// New values are written with the codec of CodecTag.
+// Changing CodecTag migrates new writes to another codec while older values stay readable.
+// []byte values are stored as is without a tag.
+// Values written before Codecs was enabled have no tag: a value whose first byte is not
+// a configured tag is decoded whole with Unmarshal, so pick tags that the untagged values
+// never start with. Values marshaled by msgpack from structs or maps start at 0x80 or above,
+// so tags below 0x80 are safe for them.
+//
+// MsgpackMapMode marshals with MsgpackMapCodec instead of the environment's Marshal and Unmarshal,
+// unless Marshal or Unmarshal are set. Map mode stores struct field names, so values
+// decode into maps and survive reordered fields, at the cost of larger values.
+// The modes cannot read each other's structs, so switching mode on existing data
+// needs a migration, or Codecs with a tag per mode.
+//
 type DbConfig struct {
-	DbName    string
-	Marshal   func(v interface{}) ([]byte, error)
-	Unmarshal func(data []byte, v interface{}) error
+	DbName           string
+	Marshal          func(v interface{}) ([]byte, error)
+	Unmarshal        func(data []byte, v interface{}) error
+	MarshalWithKey   func(key []byte, v interface{}) ([]byte, error)
+	MarshalAppend    func(dst []byte, v interface{}) ([]byte, error)
+	UnmarshalWithKey func(key []byte, data []byte, v interface{}) error
+	KeyCodec         KeyCodec
+	Flags            uint
+	TTL              bool
+	DefaultTTL       time.Duration
+	MaxEntries       int
+	Eviction         EvictionPolicy
+	OnDuplicateKey   DuplicateKeyPolicy
+	Sequence         bool
+	Audited          bool
+	BloomFilter      bool
+	Codecs           map[byte]Codec
+	CodecTag         byte
+	MsgpackMapMode   bool
+}
+
+// internalDbPrefix prefixes the names of databases used internally by lmdbstore
+const internalDbPrefix = "__lmdbstore/"
+
+// maxDBs returns the number of named databases the environment needs for config,
+// including internal sidecar databases
+func maxDBs(config LmdbEnvConfig) int {
+	n := len(config.Databases)
+	if config.Changelog {
+		n++
+	}
+	for _, dbConfig := range config.Databases {
+		if dbConfig.TTL || dbConfig.DefaultTTL > 0 {
+			n++
+		}
+		if dbConfig.MaxEntries > 0 {
+			n += 2
+		}
+		if dbConfig.Sequence {
+			n++
+		}
+		if dbConfig.Audited {
+			n++
+		}
+	}
+	return n
 }
 
 // NewLmdb initialize a single LmdbEnv
 //
-// Initialized LmdbEnv would spawn a single "updater" goroutine for Update transactions
+// Initialized LmdbEnv would spawn a single "updater" goroutine for Update transactions,
+// unless LmdbEnvConfig.SyncWrites is enabled
+//
+// Reads run in read transactions on the calling goroutine, never waiting for the updater goroutine.
+// A read running while a write transaction is in progress sees the last committed snapshot
 //
 // The methods should be safe to use across multiple goroutines
 //
@@ -122,15 +421,70 @@ func NewLmdb(config LmdbEnvConfig) (*LmdbEnv, error) {
 	if len(config.Databases) < 1 {
 		return nil, errors.New("no databases is setup")
 	}
+	if config.MemoryOnly {
+		dir, err := os.MkdirTemp(memoryOnlyDir(), "lmdbstore-")
+		if err != nil {
+			return nil, err
+		}
+		config.MemoryOnly = false
+		config.CreateDirs = false
+		config.OpenPath = dir
+		config.OpenFlag = config.OpenFlag&^lmdb.NoSubdir | lmdb.NoSync
+		env, err := NewLmdb(config)
+		if err != nil {
+			os.RemoveAll(dir)
+			return nil, err
+		}
+		env.tempDir = dir
+		return env, nil
+	}
+	if config.CreateDirs {
+		err := createDirs(config)
+		if err != nil {
+			return nil, err
+		}
+		config.CreateDirs = false
+	}
+	if config.SingleWriter {
+		writerLock, err := lockWriter(writerLockPath(config), config.OpenFSMode)
+		if err != nil {
+			return nil, err
+		}
+		config.SingleWriter = false
+		env, err := NewLmdb(config)
+		if err != nil {
+			writerLock.Close()
+			return nil, err
+		}
+		env.writerLock = writerLock
+		return env, nil
+	}
+	err := checkMapSize(config.MapSize)
+	if err != nil {
+		return nil, err
+	}
 	lmdbEnv, err := lmdb.NewEnv()
 	if err != nil {
 		return nil, err
 	}
-	err = lmdbEnv.SetMapSize(config.MapSize)
+	env, err := openLmdb(lmdbEnv, config)
+	if err != nil {
+		// on ErrOpenTimeout the environment is closed once the pending open returns
+		if err != ErrOpenTimeout {
+			lmdbEnv.Close()
+		}
+		return nil, err
+	}
+	return env, nil
+}
+
+// openLmdb applies the settings of config to lmdbEnv, opens it and wraps it with NewLmdbWithEnv
+func openLmdb(lmdbEnv *lmdb.Env, config LmdbEnvConfig) (*LmdbEnv, error) {
+	err := lmdbEnv.SetMapSize(config.MapSize)
 	if err != nil {
 		return nil, err
 	}
-	err = lmdbEnv.SetMaxDBs(len(config.Databases))
+	err = lmdbEnv.SetMaxDBs(maxDBs(config))
 	if err != nil {
 		return nil, err
 	}
@@ -138,47 +492,218 @@ func NewLmdb(config LmdbEnvConfig) (*LmdbEnv, error) {
 	if err != nil {
 		return nil, err
 	}
-	err = lmdbEnv.Open(config.OpenPath, config.OpenFlag, config.OpenFSMode)
+	openFlag := config.OpenFlag
+	if config.DisableReadahead {
+		openFlag |= lmdb.NoReadahead
+	}
+	err = openEnv(lmdbEnv, config.OpenPath, openFlag, config.OpenFSMode, config.OpenTimeout)
 	if err != nil {
-		return nil, err
+		return nil, mapOpenError(err, config.MapSize)
+	}
+	return NewLmdbWithEnv(lmdbEnv, config)
+}
+
+// createDirs creates the directory of the environment with LmdbEnvConfig.DirMode
+func createDirs(config LmdbEnvConfig) error {
+	dir := config.OpenPath
+	if config.OpenFlag&lmdb.NoSubdir != 0 {
+		dir = filepath.Dir(dir)
+	}
+	mode := config.DirMode
+	if mode == 0 {
+		mode = 0755
+	}
+	return os.MkdirAll(dir, mode)
+}
+
+// openEnv opens lmdbEnv, giving up with ErrOpenTimeout after timeout if it is positive
+//
+// lmdbEnv is closed once a timed out open finishes
+//
+func openEnv(lmdbEnv *lmdb.Env, path string, flag uint, mode fs.FileMode, timeout time.Duration) error {
+	if timeout <= 0 {
+		return lmdbEnv.Open(path, flag, mode)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- lmdbEnv.Open(path, flag, mode)
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		go func() {
+			<-done
+			lmdbEnv.Close()
+		}()
+		return ErrOpenTimeout
+	}
+}
+
+// NewLmdbWithEnv initialize a single LmdbEnv around an already opened lmdb.Env
+//
+// Only Databases, Marshal, Unmarshal, MaxValueSize, MapFullThreshold, CheckMapSpace,
+// SyncInterval, SyncWrites, CompactOnClose and Changelog of config are used,
+// the caller is responsible for every setting of lmdbEnv.
+// lmdbEnv must allow enough named databases with SetMaxDBs
+// for config.Databases and their internal sidecar databases
+//
+// As with NewLmdb, the updater goroutine is spawned
+// and LmdbEnv.Close closes lmdbEnv.
+// If an error is returned, lmdbEnv is left open for the caller to close
+//
+func NewLmdbWithEnv(lmdbEnv *lmdb.Env, config LmdbEnvConfig) (*LmdbEnv, error) {
+	if len(config.Databases) < 1 {
+		return nil, errors.New("no databases is setup")
 	}
+	var err error
 	lmdbHandler := LmdbEnv{
 		LmdbEnv:          lmdbEnv,
 		marshal:          config.Marshal,
 		unmarshal:        config.Unmarshal,
 		updateWorkerChan: make(chan *dbOp),
+		quitChan:         make(chan bool),
+		closedChan:       make(chan struct{}),
+		closingChan:      make(chan struct{}),
 		databases:        make(map[string]*Db),
+		aliases:          make(map[string]*Db),
+		syncWrites:       config.SyncWrites,
+		compactOnClose:   config.CompactOnClose,
+		maxValueSize:     config.MaxValueSize,
+		mapFullThreshold: config.MapFullThreshold,
+		mapSpaceCheck:    config.CheckMapSpace,
+		commitLatency:    newLatencyWindow(commitLatencyWindow),
+		changelog:        config.Changelog,
+	}
+	if lmdbHandler.marshal == nil {
+		lmdbHandler.marshal = DefaultLmdbConfig.Marshal
+	}
+	if lmdbHandler.unmarshal == nil {
+		lmdbHandler.unmarshal = DefaultLmdbConfig.Unmarshal
+	}
+	if config.Changelog {
+		err = lmdbEnv.Update(func(txn *lmdb.Txn) (err error) {
+			lmdbHandler.changelogDbi, err = txn.CreateDBI(internalDbPrefix + "changelog")
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error creating changelog database: %w", err)
+		}
 	}
 	for _, dbConfig := range config.Databases {
 		db := &Db{
+			name:             dbConfig.DbName,
 			lmdbEnv:          lmdbEnv,
-			updateWorkerChan: lmdbHandler.updateWorkerChan,
-			marshal:          lmdbHandler.marshal,
-			unmarshal:        lmdbHandler.unmarshal,
+			env:              &lmdbHandler,
+			marshal:          dbConfig.Marshal,
+			unmarshal:        dbConfig.Unmarshal,
+			marshalWithKey:   dbConfig.MarshalWithKey,
+			marshalAppend:    dbConfig.MarshalAppend,
+			unmarshalWithKey: dbConfig.UnmarshalWithKey,
+			keyCodec:         dbConfig.KeyCodec,
+			flags:            dbConfig.Flags,
+			ttl:              dbConfig.TTL || dbConfig.DefaultTTL > 0,
+			defaultTTL:       dbConfig.DefaultTTL,
+			maxEntries:       dbConfig.MaxEntries,
+			eviction:         dbConfig.Eviction,
+			onDuplicateKey:   dbConfig.OnDuplicateKey,
+			sequence:         dbConfig.Sequence,
+			audited:          dbConfig.Audited,
+			codecs:           dbConfig.Codecs,
+			codecTag:         dbConfig.CodecTag,
+		}
+		if db.codecs != nil {
+			if _, ok := db.codecs[db.codecTag]; !ok {
+				return nil, fmt.Errorf("database %s has no codec for CodecTag %d", dbConfig.DbName, db.codecTag)
+			}
+		}
+		if db.marshal == nil && dbConfig.MsgpackMapMode {
+			db.marshal = MsgpackMapCodec.Marshal
+		}
+		if db.unmarshal == nil && dbConfig.MsgpackMapMode {
+			db.unmarshal = MsgpackMapCodec.Unmarshal
+		}
+		if db.marshal == nil {
+			db.marshal = lmdbHandler.marshal
+		}
+		if db.unmarshal == nil {
+			db.unmarshal = lmdbHandler.unmarshal
 		}
 		err = lmdbEnv.Update(func(txn *lmdb.Txn) error {
-			db.dbi, err = txn.CreateDBI(dbConfig.DbName)
+			db.dbi, err = txn.OpenDBI(dbConfig.DbName, dbConfig.Flags|lmdb.Create)
+			if err != nil {
+				return err
+			}
+			if db.ttl {
+				db.ttlDbi, err = txn.CreateDBI(internalDbPrefix + "ttl/" + dbConfig.DbName)
+				if err != nil {
+					return err
+				}
+			}
+			if db.maxEntries > 0 {
+				db.orderDbi, err = txn.CreateDBI(internalDbPrefix + "order/" + dbConfig.DbName)
+				if err != nil {
+					return err
+				}
+				db.orderIndexDbi, err = txn.CreateDBI(internalDbPrefix + "orderindex/" + dbConfig.DbName)
+				if err != nil {
+					return err
+				}
+			}
+			if db.sequence {
+				db.seqDbi, err = txn.CreateDBI(internalDbPrefix + "seq/" + dbConfig.DbName)
+				if err != nil {
+					return err
+				}
+			}
+			if db.audited {
+				db.createdDbi, err = txn.CreateDBI(internalDbPrefix + "created/" + dbConfig.DbName)
+			}
 			return err
 		})
 		if err != nil {
 			return nil, fmt.Errorf("error creating database %s", dbConfig.DbName)
 		}
+		if dbConfig.BloomFilter {
+			err = db.buildBloomFilter()
+			if err != nil {
+				return nil, fmt.Errorf("error building bloom filter of database %s: %w", dbConfig.DbName, err)
+			}
+		}
 		lmdbHandler.databases[dbConfig.DbName] = db
 	}
+	if config.SyncWrites && config.SyncInterval <= 0 {
+		return &lmdbHandler, nil
+	}
+	lmdbHandler.updaterRunning = true
 	go func() {
 		runtime.LockOSThread()
-		defer runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		// nil channel never fires when periodic sync is disabled
+		var syncTick <-chan time.Time
+		if config.SyncInterval > 0 {
+			ticker := time.NewTicker(config.SyncInterval)
+			defer ticker.Stop()
+			syncTick = ticker.C
+		}
 		for {
 			select {
 			case op := <-lmdbHandler.updateWorkerChan:
 				{
-					op.res <- lmdbEnv.UpdateLocked(op.op)
+					atomic.AddInt64(&lmdbHandler.writeQueueDepth, -1)
+					op.res <- lmdbHandler.runUpdate(op.op)
+				}
+			case <-syncTick:
+				{
+					periodicSync(lmdbEnv)
 				}
 			case <-lmdbHandler.quitChan:
 				{
-					lmdbEnv.Sync(true)
-					lmdbEnv.Close()
-					runtime.UnlockOSThread()
+					lmdbHandler.shutdown()
+					close(lmdbHandler.closedChan)
+					return
 				}
 			}
 		}
@@ -186,43 +711,567 @@ func NewLmdb(config LmdbEnvConfig) (*LmdbEnv, error) {
 	return &lmdbHandler, nil
 }
 
+// periodicSync flushes lmdbEnv for LmdbEnvConfig.SyncInterval,
+// a variable so tests can count the syncs
+var periodicSync = func(lmdbEnv *lmdb.Env) {
+	// forced, as a plain sync is a no-op with lmdb.NoSync
+	lmdbEnv.Sync(true)
+}
+
+// runUpdate runs op in a write transaction on the calling locked OS thread
+//
+// A panic inside op is recovered and returned as an error wrapping ErrPanicInTxn.
+// The duration including the commit is recorded for CommitLatency
+//
+func (e *LmdbEnv) runUpdate(op lmdb.TxnOp) (err error) {
+	start := time.Now()
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", ErrPanicInTxn, r)
+		}
+		e.commitLatency.record(time.Since(start))
+	}()
+	return e.LmdbEnv.UpdateLocked(op)
+}
+
 // Close flushes the Lmdb databases to disk and stop the updater goroutine
 //
-// Note that closed LmdbEnv should not be used for any transactions
+// The call will block until the environment is closed,
+// later calls return immediately
+//
+// Note that closed LmdbEnv should not be used for any transactions,
+// calls blocked in WaitForKey return ErrClosed
 //
 func (e *LmdbEnv) Close() {
-	e.quitChan <- false
+	e.closeOnce.Do(func() {
+		close(e.closingChan)
+		// waits for the polls of blocked calls, which see closingChan afterwards
+		e.closeMu.Lock()
+		defer e.closeMu.Unlock()
+		if !e.updaterRunning {
+			e.shutdown()
+			return
+		}
+		e.quitChan <- false
+		<-e.closedChan
+	})
+}
+
+// CloseErr returns the error of the compaction done by Close with LmdbEnvConfig.CompactOnClose
+//
+// The environment is closed even if compaction fails
+//
+func (e *LmdbEnv) CloseErr() error {
+	return e.closeErr
+}
+
+// shutdown flushes, optionally compacts, and closes the environment
+func (e *LmdbEnv) shutdown() {
+	e.LmdbEnv.Sync(true)
+	if e.compactOnClose != "" {
+		e.closeErr = e.compactReplacing(e.compactOnClose)
+	}
+	e.LmdbEnv.Close()
+	if e.writerLock != nil {
+		e.writerLock.Close()
+	}
+	if e.tempDir != "" {
+		os.RemoveAll(e.tempDir)
+	}
+}
+
+// memoryOnlyDir returns the parent directory of LmdbEnvConfig.MemoryOnly environments
+func memoryOnlyDir() string {
+	info, err := os.Stat("/dev/shm")
+	if err == nil && info.IsDir() {
+		return "/dev/shm"
+	}
+	return os.TempDir()
+}
+
+// compactReplacing is CompactTo replacing an existing copy in path
+//
+// The copy is written into a temporary directory next to the data file
+// and renamed over it, so an existing copy stays intact if compaction fails
+//
+func (e *LmdbEnv) compactReplacing(path string) error {
+	dir, dataFile, err := e.compactPaths(path)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.MkdirTemp(dir, ".compact-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	tmpCopy := tmp
+	if dataFile == path {
+		tmpCopy = filepath.Join(tmp, "data.mdb")
+	}
+	err = e.LmdbEnv.CopyFlag(tmpCopy, lmdb.CopyCompact)
+	if err != nil {
+		return err
+	}
+	return os.Rename(filepath.Join(tmp, "data.mdb"), dataFile)
+}
+
+// compactPaths returns the directory and the data file of a copy written to path
+//
+// With lmdb.NoSubdir the copy is the data file path itself, inside its parent directory
+//
+func (e *LmdbEnv) compactPaths(path string) (dir, dataFile string, err error) {
+	flags, err := e.LmdbEnv.Flags()
+	if err != nil {
+		return "", "", err
+	}
+	if flags&lmdb.NoSubdir != 0 {
+		return filepath.Dir(path), path, nil
+	}
+	return path, filepath.Join(path, "data.mdb"), nil
+}
+
+// CompactTo writes a compacted copy of the environment into the directory path
+//
+// path is created if needed and must not contain an existing database.
+// With lmdb.NoSubdir path is the data file of the copy, only its parent directory is created
+// and path must not exist.
+// The copy omits free pages, so it is usually smaller than the original
+//
+func (e *LmdbEnv) CompactTo(path string) error {
+	dir, _, err := e.compactPaths(path)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	return e.LmdbEnv.CopyFlag(path, lmdb.CopyCompact)
 }
 
 // UpdateTxn runs a lmdb.TxnOp inside the updater goroutine
 //
+// Reads inside op see the writes op made earlier in the same transaction,
+// before they are committed. Values read inside op point into the transaction
+// and may change after later writes in op, copy them before writing if they are still needed.
+//
+// If op returns an error, the transaction is aborted and nothing is written.
+// op may write any database, so the bloom filters of DbConfig.BloomFilter databases
+// are disabled until rebuilt with RebuildBloomFilter.
+// Writes done by op are not recorded by LmdbEnvConfig.Changelog
+//
 // The call will block until the transaction is finished
 //
 func (s *Db) UpdateTxn(op lmdb.TxnOp) error {
+	return s.env.updateTxn(func(txn *lmdb.Txn) error {
+		s.env.invalidateBloomFilters()
+		return op(txn)
+	})
+}
+
+// update runs op inside the updater goroutine, for writes keeping the sidecars up to date
+func (s *Db) update(op lmdb.TxnOp) error {
+	return s.env.updateTxn(op)
+}
+
+// updateTxn runs a lmdb.TxnOp inside the updater goroutine,
+// or on the calling goroutine with LmdbEnvConfig.SyncWrites
+func (e *LmdbEnv) updateTxn(op lmdb.TxnOp) error {
+	if e.syncWrites {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		return e.runUpdate(op)
+	}
 	res := make(chan error)
-	s.updateWorkerChan <- &dbOp{op, res}
+	atomic.AddInt64(&e.writeQueueDepth, 1)
+	e.updateWorkerChan <- &dbOp{op, res}
 	err := <-res
 	return err
 }
 
+// WriteQueueDepth returns the number of write transactions waiting for the updater goroutine
+//
+// The transaction currently being run by the updater goroutine is not counted.
+// A growing depth indicates writes are backing up
+//
+func (e *LmdbEnv) WriteQueueDepth() int {
+	return int(atomic.LoadInt64(&e.writeQueueDepth))
+}
+
 // Put a value with key inside the database
 //
+// []byte values are stored as is, other values are marshaled.
+// nil and nil pointers are rejected with ErrNilValue,
+// while a nil or empty []byte stores a zero-length value
+//
 // The call will block until the transaction is finished
 //
 func (s *Db) Put(key []byte, value interface{}) error {
-	return s.UpdateTxn(func(txn *lmdb.Txn) error {
-		switch v := value.(type) {
-		case []byte:
-			return txn.Put(s.dbi, key, v, 0)
-		default:
-			{
-				b, err := s.marshal(v)
+	return s.update(func(txn *lmdb.Txn) error {
+		return s.putValue(txn, key, value)
+	})
+}
+
+// encode returns the bytes to be stored for value at key
+//
+// []byte values are stored as is, other values are marshaled with the Db's Marshal
+//
+// nil and nil pointers are rejected with ErrNilValue
+//
+func (s *Db) encode(key []byte, value interface{}) ([]byte, error) {
+	b, _, err := s.encodeAppend(nil, key, value)
+	return b, err
+}
+
+// encodeAppend is encode marshaling with DbConfig.MarshalAppend onto dst when set
+//
+// appended reports whether b was appended onto dst, so its buffer can be reused
+//
+func (s *Db) encodeAppend(dst []byte, key []byte, value interface{}) (b []byte, appended bool, err error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, false, ErrNilValue
+	case []byte:
+		return v, false, nil
+	default:
+		if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr && rv.IsNil() {
+			return nil, false, ErrNilValue
+		}
+		if s.codecs != nil {
+			b, err = s.encodeTagged(v)
+			return b, false, err
+		}
+		if s.marshalWithKey != nil {
+			b, err = s.marshalWithKey(key, v)
+			return b, false, err
+		}
+		if s.marshalAppend != nil {
+			b, err = s.marshalAppend(dst, v)
+			return b, err == nil, err
+		}
+		b, err = s.marshal(v)
+		return b, false, err
+	}
+}
+
+// decode unmarshals data read from key into dest
+func (s *Db) decode(key []byte, data []byte, dest interface{}) error {
+	if s.codecs != nil {
+		return s.decodeTagged(data, dest)
+	}
+	if s.unmarshalWithKey != nil {
+		return s.unmarshalWithKey(key, data, dest)
+	}
+	return s.unmarshal(data, dest)
+}
+
+// PutSized puts a value with key inside the database like Put
+// and returns the number of value bytes stored
+//
+// The size is counted after marshaling, including the codec tag of DbConfig.Codecs
+//
+// The call will block until the transaction is finished
+//
+func (s *Db) PutSized(key []byte, value interface{}) (size int, err error) {
+	b, err := s.encode(key, value)
+	if err != nil {
+		return 0, err
+	}
+	err = s.update(func(txn *lmdb.Txn) error {
+		return s.put(txn, key, b, 0)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// maxWriteBufSize bounds the capacity of the write buffer kept between writes
+const maxWriteBufSize = 1 << 20
+
+// putValue encodes value and puts it at key inside txn
+//
+// Inside the updater goroutine, values are marshaled into the reused write buffer
+// with DbConfig.MarshalAppend, which is safe as the value is copied by the put
+//
+func (s *Db) putValue(txn *lmdb.Txn, key []byte, value interface{}) error {
+	if s.marshalAppend == nil || s.env.syncWrites {
+		b, err := s.encode(key, value)
+		if err != nil {
+			return err
+		}
+		return s.put(txn, key, b, 0)
+	}
+	b, appended, err := s.encodeAppend(s.env.writeBuf[:0], key, value)
+	if err != nil {
+		return err
+	}
+	if appended && cap(b) <= maxWriteBufSize {
+		s.env.writeBuf = b
+	}
+	return s.put(txn, key, b, 0)
+}
+
+// put stores the already encoded b at key inside txn
+//
+// Any expiry previously set on key is cleared, or reset to DbConfig.DefaultTTL
+//
+func (s *Db) put(txn *lmdb.Txn, key []byte, b []byte, flags uint) error {
+	err := s.checkValueSize(len(b))
+	if err != nil {
+		return err
+	}
+	err = s.env.checkMapUsage(txn)
+	if err != nil {
+		return err
+	}
+	err = s.env.checkMapSpace(txn, len(key)+len(b))
+	if err != nil {
+		return err
+	}
+	err = txn.Put(s.dbi, key, b, flags)
+	if err != nil {
+		return err
+	}
+	return s.afterPut(txn, key)
+}
+
+// afterPut updates the sidecar databases after key is written inside txn
+func (s *Db) afterPut(txn *lmdb.Txn, key []byte) error {
+	if s.bloom != nil {
+		// added before commit, so readers never miss a committed key
+		s.bloom.add(key)
+	}
+	var err error
+	if s.defaultTTL > 0 {
+		err = s.setExpiry(txn, key, time.Now().Add(s.defaultTTL))
+	} else {
+		err = s.clearExpiry(txn, key)
+	}
+	if err != nil {
+		return err
+	}
+	err = s.env.recordChange(txn, s, OpPut, key)
+	if err != nil {
+		return err
+	}
+	return s.trackWrite(txn, key)
+}
+
+// afterDel updates the sidecar databases after key is deleted inside txn
+func (s *Db) afterDel(txn *lmdb.Txn, key []byte) error {
+	err := s.clearExpiry(txn, key)
+	if err != nil {
+		return err
+	}
+	err = s.clearCreated(txn, key)
+	if err != nil {
+		return err
+	}
+	err = s.env.recordChange(txn, s, OpDel, key)
+	if err != nil {
+		return err
+	}
+	return s.untrack(txn, key)
+}
+
+// dbis returns the DBI of the database followed by the DBIs of its sidecar databases
+func (s *Db) dbis() []lmdb.DBI {
+	dbis := []lmdb.DBI{s.dbi}
+	if s.ttl {
+		dbis = append(dbis, s.ttlDbi)
+	}
+	if s.maxEntries > 0 {
+		dbis = append(dbis, s.orderDbi, s.orderIndexDbi)
+	}
+	if s.sequence {
+		dbis = append(dbis, s.seqDbi)
+	}
+	if s.audited {
+		dbis = append(dbis, s.createdDbi)
+	}
+	return dbis
+}
+
+// dropSidecars empties the sidecar databases inside txn
+func (s *Db) dropSidecars(txn *lmdb.Txn) error {
+	if s.ttl {
+		err := txn.Drop(s.ttlDbi, false)
+		if err != nil {
+			return err
+		}
+	}
+	if s.maxEntries > 0 {
+		err := txn.Drop(s.orderDbi, false)
+		if err != nil {
+			return err
+		}
+		err = txn.Drop(s.orderIndexDbi, false)
+		if err != nil {
+			return err
+		}
+	}
+	if s.audited {
+		return txn.Drop(s.createdDbi, false)
+	}
+	return nil
+}
+
+// checkValueSize returns ErrValueTooLarge if size exceeds LmdbEnvConfig.MaxValueSize
+func (s *Db) checkValueSize(size int) error {
+	if s.env.maxValueSize > 0 && size > s.env.maxValueSize {
+		return ErrValueTooLarge
+	}
+	return nil
+}
+
+// get returns the value at key inside txn without copying it
+//
+// Expired keys are reported as ErrNotFound
+//
+func (s *Db) get(txn *lmdb.Txn, key []byte) ([]byte, error) {
+	if s.definitelyAbsent(key) {
+		return nil, ErrNotFound
+	}
+	b, err := txn.Get(s.dbi, key)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	expired, err := s.expired(txn, key)
+	if err != nil {
+		return nil, err
+	}
+	if expired {
+		return nil, ErrNotFound
+	}
+	return b, nil
+}
+
+// del removes key inside txn
+func (s *Db) del(txn *lmdb.Txn, key []byte) error {
+	err := txn.Del(s.dbi, key, zeroLengthBytes)
+	if err != nil {
+		return notFound(err)
+	}
+	return s.afterDel(txn, key)
+}
+
+// PutFlags puts the binary value with key inside the database using lmdb put flags
+//
+// Valid flags are lmdb.NoOverwrite and lmdb.Append for all databases,
+// and lmdb.NoDupData and lmdb.AppendDup for databases opened with lmdb.DupSort.
+//
+// With lmdb.NoOverwrite, an existing key returns an error satisfying lmdb.IsErrno(err, lmdb.KeyExist)
+//
+// The call will block until the transaction is finished
+//
+func (s *Db) PutFlags(key []byte, value []byte, flags uint) error {
+	return s.update(func(txn *lmdb.Txn) error {
+		return s.put(txn, key, value, flags)
+	})
+}
+
+// PutAppendDup appends value to the duplicates of key inside a lmdb.DupSort database
+//
+// Values must be appended in sorted order, as is the case for bulk loads of pre-sorted data.
+// An out of order value returns an error satisfying lmdb.IsErrno(err, lmdb.KeyExist)
+//
+// The call will block until the transaction is finished
+//
+func (s *Db) PutAppendDup(key, value []byte) error {
+	err := s.requireFlags(lmdb.DupSort, "DupSort")
+	if err != nil {
+		return err
+	}
+	return s.PutFlags(key, value, lmdb.AppendDup)
+}
+
+// GetMultiple returns every duplicate of key inside a lmdb.DupFixed database
+//
+// The duplicates are bulk-read a page at a time with lmdb.GetMultiple and lmdb.NextMultiple,
+// and returned in sorted order
+//
+// The returned values are copied for safe use outside the lmdb.TxnOp
+//
+func (s *Db) GetMultiple(key []byte) (values [][]byte, err error) {
+	err = s.requireFlags(lmdb.DupSort|lmdb.DupFixed, "DupFixed")
+	if err != nil {
+		return nil, err
+	}
+	err = s.lmdbEnv.View(func(txn *lmdb.Txn) error {
+		first, err := s.get(txn, key)
+		if err != nil {
+			return err
+		}
+		stride := len(first)
+		return s.cursorDo(txn, func(cur *lmdb.Cursor) error {
+			_, _, err := cur.Get(key, nil, lmdb.Set)
+			if err != nil {
+				return notFound(err)
+			}
+			op := uint(lmdb.GetMultiple)
+			for {
+				_, page, err := cur.Get(nil, nil, op)
+				if lmdb.IsNotFound(err) {
+					return nil
+				}
 				if err != nil {
 					return err
 				}
-				return txn.Put(s.dbi, key, b, 0)
+				for _, v := range lmdb.WrapMulti(page, stride).Vals() {
+					values = append(values, append([]byte(nil), v...))
+				}
+				op = lmdb.NextMultiple
 			}
+		})
+	})
+	return values, err
+}
+
+// requireFlags returns an error unless the database was opened with flags
+func (s *Db) requireFlags(flags uint, name string) error {
+	if s.flags&flags != flags {
+		return fmt.Errorf("database is not opened with lmdb.%s", name)
+	}
+	return nil
+}
+
+// PutReserve reserves size bytes at key and calls fill to write the value in place
+//
+// fill receives the buffer inside the memory map, avoiding an extra copy for large values.
+// The buffer must not be used after fill returns.
+//
+// If fill returns an error, the write is aborted and the error is returned
+//
+// The call will block until the transaction is finished
+//
+func (s *Db) PutReserve(key []byte, size int, fill func(buf []byte) error) error {
+	err := s.checkValueSize(size)
+	if err != nil {
+		return err
+	}
+	return s.update(func(txn *lmdb.Txn) error {
+		err := s.env.checkMapUsage(txn)
+		if err != nil {
+			return err
+		}
+		err = s.env.checkMapSpace(txn, len(key)+size)
+		if err != nil {
+			return err
+		}
+		buf, err := txn.PutReserve(s.dbi, key, size, 0)
+		if err != nil {
+			return err
+		}
+		err = fill(buf)
+		if err != nil {
+			return err
 		}
+		return s.afterPut(txn, key)
 	})
 }
 
@@ -230,11 +1279,13 @@ var zeroLengthBytes = make([]byte, 0)
 
 // Del a value with key inside the database
 //
+// If the key does not exist, ErrNotFound is returned
+//
 // The call will block until the transaction is finished
 //
 func (s *Db) Del(key []byte) error {
-	return s.UpdateTxn(func(txn *lmdb.Txn) error {
-		return txn.Del(s.dbi, key, zeroLengthBytes)
+	return s.update(func(txn *lmdb.Txn) error {
+		return s.del(txn, key)
 	})
 }
 
@@ -243,40 +1294,241 @@ func (s *Db) Del(key []byte) error {
 // The call will block until the transaction is finished
 //
 func (s *Db) Drop() error {
-	return s.UpdateTxn(func(txn *lmdb.Txn) error {
-		return txn.Drop(s.dbi, false)
+	return s.update(func(txn *lmdb.Txn) error {
+		err := txn.Drop(s.dbi, false)
+		if err != nil {
+			return err
+		}
+		err = s.dropSidecars(txn)
+		if err != nil {
+			return err
+		}
+		return s.env.recordChange(txn, s, OpDrop, nil)
+	})
+}
+
+// Compact rebuilds the database in a single transaction, reading every entry,
+// dropping the database and reinserting the entries in key order with lmdb.Append
+//
+// Appending fills the pages completely, reducing the pages fragmented by random writes and deletes.
+// Every entry is copied into memory during the transaction, so Compact transiently holds
+// a copy of the whole database in memory, and the map must fit the rebuilt pages
+// until the dropped pages are freed on commit.
+// Sidecar databases are left unchanged as the keys do not change.
+// With LmdbEnvConfig.Changelog, an OpDrop followed by an OpPut for every reinserted entry is recorded
+//
+// The call will block until the transaction is finished
+//
+func (s *Db) Compact() error {
+	return s.update(func(txn *lmdb.Txn) error {
+		var kvs []KV
+		err := s.walkRangeRaw(txn, nil, nil, func(key, value []byte) error {
+			kvs = append(kvs, newKV(key, value))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		err = txn.Drop(s.dbi, false)
+		if err != nil {
+			return err
+		}
+		err = s.env.recordChange(txn, s, OpDrop, nil)
+		if err != nil {
+			return err
+		}
+		for i, kv := range kvs {
+			flags := uint(lmdb.Append)
+			// further values of a lmdb.DupSort key are appended to its duplicates
+			if i > 0 && bytes.Equal(kv.Key, kvs[i-1].Key) {
+				flags = lmdb.AppendDup
+			}
+			err = txn.Put(s.dbi, kv.Key, kv.Value, flags)
+			if err == nil {
+				err = s.env.recordChange(txn, s, OpPut, kv.Key)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DropAll empties every configured database in a single transaction
+//
+// The databases stay open and usable, as after Db.Drop
+//
+// The call will block until the transaction is finished
+//
+func (l *LmdbEnv) DropAll() error {
+	return l.updateTxn(func(txn *lmdb.Txn) error {
+		for name, db := range l.databases {
+			err := txn.Drop(db.dbi, false)
+			if err == nil {
+				err = db.dropSidecars(txn)
+			}
+			if err == nil {
+				err = l.recordChange(txn, db, OpDrop, nil)
+			}
+			if err != nil {
+				return fmt.Errorf("database %s: %w", name, err)
+			}
+		}
+		return nil
 	})
 }
 
 // Get returns the binary value at key inside the database
 //
-// If the key does not exist, an error is returned
+// If the key does not exist, ErrNotFound is returned
 //
 // The returned value is copied for safe use outside the lmdb.TxnOp
 //
 func (s *Db) Get(key []byte) (b []byte, err error) {
+	if s.definitelyAbsent(key) {
+		return nil, ErrNotFound
+	}
 	err = s.lmdbEnv.View(func(txn *lmdb.Txn) (err error) {
-		bOri, err := txn.Get(s.dbi, key)
+		bOri, err := s.get(txn, key)
 		if err != nil {
 			return err
 		}
+		b = make([]byte, len(bOri))
 		copy(b, bOri)
 		return nil
 	})
 	return b, err
 }
 
+// GetRaw returns the exact bytes stored at key inside the database
+//
+// Like Get, the value is not decoded, so it includes the codec tag of DbConfig.Codecs.
+// Unlike Get, the bloom filter and expiry are bypassed,
+// so keys expired but not yet purged are still returned.
+// If the key is not stored, ErrNotFound is returned
+//
+// The returned value is copied for safe use outside the lmdb.TxnOp
+//
+func (s *Db) GetRaw(key []byte) (b []byte, err error) {
+	err = s.lmdbEnv.View(func(txn *lmdb.Txn) error {
+		bOri, err := txn.Get(s.dbi, key)
+		if lmdb.IsNotFound(err) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		b = copyBytes(bOri)
+		return nil
+	})
+	return b, err
+}
+
+// Lookup returns the binary value at key inside the database
+//
+// If the key does not exist, ok is false and err is nil.
+// err is only set for failures other than a missing key
+//
+// The returned value is copied for safe use outside the lmdb.TxnOp
+//
+func (s *Db) Lookup(key []byte) (value []byte, ok bool, err error) {
+	value, err = s.Get(key)
+	if err == ErrNotFound {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// GetOrDefault returns the binary value at key inside the database,
+// or def if the key does not exist
+//
+// err is only set for failures other than a missing key
+//
+// The returned value is copied for safe use outside the lmdb.TxnOp, def is returned as is
+//
+func (s *Db) GetOrDefault(key, def []byte) ([]byte, error) {
+	value, ok, err := s.Lookup(key)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return def, nil
+	}
+	return value, nil
+}
+
+// Peek calls fn with the value at key inside the database without copying it
+//
+// If the key does not exist, ErrNotFound is returned and fn is not called
+//
+// The value points into the memory map and is only valid until fn returns.
+// It must not be modified or retained, copy it if needed after fn returns
+//
+func (s *Db) Peek(key []byte, fn func(value []byte) error) error {
+	if s.definitelyAbsent(key) {
+		return ErrNotFound
+	}
+	return s.lmdbEnv.View(func(txn *lmdb.Txn) error {
+		// lmdb-go copies values out of the memory map unless RawRead is set
+		txn.RawRead = true
+		b, err := s.get(txn, key)
+		if err != nil {
+			return err
+		}
+		return fn(b)
+	})
+}
+
+// EntryMeta is metadata about a stored entry returned by Db.GetMeta
+type EntryMeta struct {
+	// length of the stored value in bytes
+	Size int
+	// ID of the transaction snapshot the entry was read from
+	TxnID int64
+}
+
+// GetMeta returns the binary value at key inside the database along with its metadata
+//
+// If the key does not exist, ErrNotFound is returned
+//
+// The returned value is copied for safe use outside the lmdb.TxnOp
+//
+func (s *Db) GetMeta(key []byte) (value []byte, meta EntryMeta, err error) {
+	err = s.lmdbEnv.View(func(txn *lmdb.Txn) error {
+		bOri, err := s.get(txn, key)
+		if err != nil {
+			return err
+		}
+		value = make([]byte, len(bOri))
+		copy(value, bOri)
+		meta = EntryMeta{Size: len(bOri), TxnID: int64(txn.ID())}
+		return nil
+	})
+	return value, meta, err
+}
+
 // GetAndMarshal marshals value at key into &dest
 //
-// If the key does not exist, an error is returned
+// If the key does not exist, ErrNotFound is returned
+//
+// The default msgpack codec encodes structs as arrays without field names,
+// so a struct value decodes into a struct but not into a map[string]interface{}.
+// Map values round-trip into maps, DbConfig.MsgpackMapMode stores structs as maps instead
 //
 // The value is first copied for safe use outside the lmdb.TxnOp
 //
 // Returned value is safe to use across goroutines
 //
 func (s *Db) GetAndMarshal(key []byte, dest interface{}) (err error) {
+	if s.definitelyAbsent(key) {
+		return ErrNotFound
+	}
 	return s.lmdbEnv.View(func(txn *lmdb.Txn) error {
-		bOri, err := txn.Get(s.dbi, key)
+		bOri, err := s.get(txn, key)
 		if err != nil {
 			return err
 		}
@@ -285,7 +1537,43 @@ func (s *Db) GetAndMarshal(key []byte, dest interface{}) (err error) {
 		}
 		b := make([]byte, len(bOri))
 		copy(b, bOri)
-		err = s.unmarshal(b, &dest)
+		err = s.decode(key, b, &dest)
 		return err
 	})
 }
+
+// GetAllInto marshals the value at each of keys into the dest at the same index inside a single View
+//
+// keys and dests must have the same length. Every key is attempted,
+// the returned error is the failure of the first failed key, wrapping ErrNotFound for a missing key,
+// and counts the keys that failed after it.
+// dests of failed keys are left unchanged
+//
+func (s *Db) GetAllInto(keys [][]byte, dests []interface{}) error {
+	if len(keys) != len(dests) {
+		return fmt.Errorf("%d keys but %d dests", len(keys), len(dests))
+	}
+	var errs []error
+	err := s.lmdbEnv.View(func(txn *lmdb.Txn) error {
+		errs = nil
+		for i, key := range keys {
+			bOri, err := s.get(txn, key)
+			if err == nil && len(bOri) == 0 {
+				err = errors.New("zero length bytes from database")
+			}
+			if err == nil {
+				b := make([]byte, len(bOri))
+				copy(b, bOri)
+				err = s.decode(key, b, &dests[i])
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("key %q: %w", key, err))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return firstError(errs)
+}
@@ -0,0 +1,1259 @@
+package lmdbstore
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bmatsuo/lmdb-go/lmdb"
+)
+
+// newTestEnv opens an environment in a temporary directory with dbs, closed when the test ends
+func newTestEnv(t testing.TB, dbs ...DbConfig) *LmdbEnv {
+	t.Helper()
+	config := DefaultLmdbConfig
+	config.Databases = dbs
+	return newTestEnvConfig(t, config)
+}
+
+// newTestEnvConfig opens an environment with config in a temporary directory, closed when the test ends
+func newTestEnvConfig(t testing.TB, config LmdbEnvConfig) *LmdbEnv {
+	t.Helper()
+	config.OpenPath = t.TempDir()
+	env, err := NewLmdb(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(env.Close)
+	return env
+}
+
+// mustPut puts value at key, failing the test on error
+func mustPut(t testing.TB, db *Db, key string, value interface{}) {
+	t.Helper()
+	err := db.Put([]byte(key), value)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// mustGet returns the value at key, failing the test on error
+func mustGet(t testing.TB, db *Db, key string) string {
+	t.Helper()
+	b, err := db.Get([]byte(key))
+	if err != nil {
+		t.Fatalf("get %q: %v", key, err)
+	}
+	return string(b)
+}
+
+func TestLookup(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	mustPut(t, db, "present", []byte("v"))
+
+	value, ok, err := db.Lookup([]byte("present"))
+	if err != nil || !ok || string(value) != "v" {
+		t.Fatalf("present: %q, %v, %v", value, ok, err)
+	}
+	value, ok, err = db.Lookup([]byte("absent"))
+	if err != nil || ok || value != nil {
+		t.Fatalf("absent: %q, %v, %v", value, ok, err)
+	}
+	// lmdb rejects empty keys with a real error
+	_, ok, err = db.Lookup([]byte{})
+	if err == nil || ok {
+		t.Fatalf("empty key: %v, %v, want an error", ok, err)
+	}
+}
+
+func TestErrNotFoundIsOpError(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	_, getErr := db.Get([]byte("absent"))
+	delErr := db.Del([]byte("absent"))
+	for op, err := range map[string]error{"Get": getErr, "Del": delErr} {
+		if err != ErrNotFound || !lmdb.IsNotFound(err) {
+			t.Fatalf("%s: %v, want ErrNotFound", op, err)
+		}
+		// misses keep the type lmdb returned before ErrNotFound was added
+		if opErr, ok := err.(*lmdb.OpError); !ok || opErr.Errno != lmdb.NotFound {
+			t.Fatalf("%s: %#v, want an *lmdb.OpError of lmdb.NotFound", op, err)
+		}
+	}
+}
+
+func TestGetReturnsCopy(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	mustPut(t, db, "k", []byte("value"))
+	b, err := db.Get([]byte("k"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b[0] = 'X'
+	if got := mustGet(t, db, "k"); got != "value" {
+		t.Fatalf("stored value changed to %q through the returned slice", got)
+	}
+}
+
+func TestMarshalWithKey(t *testing.T) {
+	// prefixedJSON tags the JSON encoding with the namespace of the key
+	marshal := func(key []byte, v interface{}) ([]byte, error) {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		if bytes.HasPrefix(key, []byte("user/")) {
+			return append([]byte("U:"), b...), nil
+		}
+		return append([]byte("X:"), b...), nil
+	}
+	unmarshal := func(key []byte, data []byte, v interface{}) error {
+		return json.Unmarshal(data[2:], v)
+	}
+	db := newTestEnv(t, DbConfig{DbName: "a", MarshalWithKey: marshal, UnmarshalWithKey: unmarshal}).GetDatabase("a")
+	mustPut(t, db, "user/1", "alice")
+	mustPut(t, db, "group/1", "admins")
+	if got := mustGet(t, db, "user/1"); got != `U:"alice"` {
+		t.Fatalf("user/1 stored as %q", got)
+	}
+	if got := mustGet(t, db, "group/1"); got != `X:"admins"` {
+		t.Fatalf("group/1 stored as %q", got)
+	}
+	var name string
+	if err := db.GetAndMarshal([]byte("user/1"), &name); err != nil || name != "alice" {
+		t.Fatalf("decoded %q, %v", name, err)
+	}
+}
+
+func TestPerDatabaseMarshal(t *testing.T) {
+	env := newTestEnv(t, DbConfig{DbName: "msgpack"}, DbConfig{DbName: "json", Marshal: json.Marshal, Unmarshal: json.Unmarshal})
+	mustPut(t, env.GetDatabase("json"), "k", map[string]int{"n": 1})
+	if got := mustGet(t, env.GetDatabase("json"), "k"); got != `{"n":1}` {
+		t.Fatalf("json database stored %q", got)
+	}
+	var v map[string]int
+	if err := env.GetDatabase("json").GetAndMarshal([]byte("k"), &v); err != nil || v["n"] != 1 {
+		t.Fatalf("decoded %v, %v", v, err)
+	}
+	mustPut(t, env.GetDatabase("msgpack"), "k", map[string]int{"n": 1})
+	if got := mustGet(t, env.GetDatabase("msgpack"), "k"); got == `{"n":1}` {
+		t.Fatal("msgpack database used the json Marshal of another database")
+	}
+}
+
+func TestPutFlagsNoOverwrite(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	if err := db.PutFlags([]byte("k"), []byte("first"), lmdb.NoOverwrite); err != nil {
+		t.Fatal(err)
+	}
+	err := db.PutFlags([]byte("k"), []byte("second"), lmdb.NoOverwrite)
+	if !lmdb.IsErrno(err, lmdb.KeyExist) {
+		t.Fatalf("err = %v, want KeyExist", err)
+	}
+	if got := mustGet(t, db, "k"); got != "first" {
+		t.Fatalf("value = %q, want first", got)
+	}
+	if err := db.PutFlags([]byte("k"), []byte("second"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := mustGet(t, db, "k"); got != "second" {
+		t.Fatalf("value = %q, want second", got)
+	}
+}
+
+func TestPutReserve(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	const size = 1 << 20
+	err := db.PutReserve([]byte("big"), size, func(buf []byte) error {
+		for i := range buf {
+			buf[i] = byte(i)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := db.Get([]byte("big"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) != size {
+		t.Fatalf("len = %d, want %d", len(b), size)
+	}
+	for i := range b {
+		if b[i] != byte(i) {
+			t.Fatalf("byte %d = %d", i, b[i])
+		}
+	}
+
+	errFill := errors.New("fill failed")
+	err = db.PutReserve([]byte("aborted"), 16, func(buf []byte) error {
+		return errFill
+	})
+	if err != errFill {
+		t.Fatalf("err = %v, want errFill", err)
+	}
+	if _, err := db.Get([]byte("aborted")); err != ErrNotFound {
+		t.Fatalf("aborted write: %v, want ErrNotFound", err)
+	}
+}
+
+func TestDisableReadahead(t *testing.T) {
+	config := DefaultLmdbConfig
+	config.Databases = []DbConfig{{DbName: "a"}}
+	config.DisableReadahead = true
+	env := newTestEnvConfig(t, config)
+	flags, err := env.LmdbEnv.Flags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flags&lmdb.NoReadahead == 0 {
+		t.Fatalf("flags %#x do not include NoReadahead", flags)
+	}
+	db := env.GetDatabase("a")
+	mustPut(t, db, "k", []byte("v"))
+	if got := mustGet(t, db, "k"); got != "v" {
+		t.Fatalf("value = %q", got)
+	}
+}
+
+func TestWriteQueueDepth(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	started, release := make(chan struct{}), make(chan struct{})
+	blocked := make(chan error)
+	go func() {
+		blocked <- db.UpdateTxn(func(txn *lmdb.Txn) error {
+			close(started)
+			<-release
+			return nil
+		})
+	}()
+	<-started
+	if depth := db.env.WriteQueueDepth(); depth != 0 {
+		t.Fatalf("depth = %d while only the running op exists, want 0", depth)
+	}
+	const queued = 3
+	done := make(chan error, queued)
+	for i := 0; i < queued; i++ {
+		go func(i int) {
+			done <- db.Put([]byte{byte(i)}, []byte("v"))
+		}(i)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for db.env.WriteQueueDepth() != queued {
+		if time.Now().After(deadline) {
+			t.Fatalf("depth = %d, want %d", db.env.WriteQueueDepth(), queued)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	if err := <-blocked; err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < queued; i++ {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if depth := db.env.WriteQueueDepth(); depth != 0 {
+		t.Fatalf("depth = %d after the queue drained, want 0", depth)
+	}
+}
+
+func TestMaxValueSize(t *testing.T) {
+	config := DefaultLmdbConfig
+	config.Databases = []DbConfig{{DbName: "a"}}
+	config.MaxValueSize = 8
+	db := newTestEnvConfig(t, config).GetDatabase("a")
+	if err := db.Put([]byte("at"), make([]byte, 8)); err != nil {
+		t.Fatalf("value at the limit: %v", err)
+	}
+	if err := db.Put([]byte("over"), make([]byte, 9)); err != ErrValueTooLarge {
+		t.Fatalf("value over the limit: %v, want ErrValueTooLarge", err)
+	}
+	// the limit applies to the marshaled size, a string of 8 bytes marshals to 9
+	if err := db.Put([]byte("marshaled"), "12345678"); err != ErrValueTooLarge {
+		t.Fatalf("marshaled value over the limit: %v, want ErrValueTooLarge", err)
+	}
+	if err := db.PutReserve([]byte("reserve"), 9, func([]byte) error { return nil }); err != ErrValueTooLarge {
+		t.Fatalf("reserve over the limit: %v, want ErrValueTooLarge", err)
+	}
+	for _, key := range []string{"over", "marshaled", "reserve"} {
+		if _, err := db.Get([]byte(key)); err != ErrNotFound {
+			t.Fatalf("%s: %v, want ErrNotFound", key, err)
+		}
+	}
+}
+
+func TestPutNilValue(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	if err := db.Put([]byte("nil"), nil); err != ErrNilValue {
+		t.Fatalf("nil: %v, want ErrNilValue", err)
+	}
+	var record *testRecord
+	if err := db.Put([]byte("typed"), record); err != ErrNilValue {
+		t.Fatalf("typed nil pointer: %v, want ErrNilValue", err)
+	}
+	if err := db.Put([]byte("empty"), []byte{}); err != nil {
+		t.Fatalf("empty value: %v", err)
+	}
+	if got := mustGet(t, db, "empty"); got != "" {
+		t.Fatalf("empty value = %q", got)
+	}
+}
+
+func TestPanicInTxn(t *testing.T) {
+	for _, syncWrites := range []bool{false, true} {
+		config := DefaultLmdbConfig
+		config.Databases = []DbConfig{{DbName: "a"}}
+		config.SyncWrites = syncWrites
+		db := newTestEnvConfig(t, config).GetDatabase("a")
+		err := db.UpdateTxn(func(txn *lmdb.Txn) error {
+			if err := txn.Put(db.dbi, []byte("partial"), []byte("v"), 0); err != nil {
+				return err
+			}
+			panic("boom")
+		})
+		if !errors.Is(err, ErrPanicInTxn) {
+			t.Fatalf("SyncWrites %v: err = %v, want ErrPanicInTxn", syncWrites, err)
+		}
+		if _, err := db.Get([]byte("partial")); err != ErrNotFound {
+			t.Fatalf("SyncWrites %v: write of the panicked transaction: %v, want ErrNotFound", syncWrites, err)
+		}
+		mustPut(t, db, "after", []byte("v"))
+		if got := mustGet(t, db, "after"); got != "v" {
+			t.Fatalf("SyncWrites %v: write after the panic = %q", syncWrites, got)
+		}
+	}
+}
+
+func TestNewLmdbWithEnv(t *testing.T) {
+	lmdbEnv, err := lmdb.NewEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lmdbEnv.SetMaxDBs(4); err != nil {
+		t.Fatal(err)
+	}
+	if err := lmdbEnv.SetMapSize(1 << 24); err != nil {
+		t.Fatal(err)
+	}
+	if err := lmdbEnv.Open(t.TempDir(), lmdb.NoSync, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := DefaultLmdbConfig
+	config.Databases = nil
+	if _, err := NewLmdbWithEnv(lmdbEnv, config); err == nil {
+		t.Fatal("opened without databases")
+	}
+	// the failed call leaves lmdbEnv open for reuse
+	config.Databases = []DbConfig{{DbName: "a"}, {DbName: "b", TTL: true}}
+	env, err := NewLmdbWithEnv(lmdbEnv, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.Close()
+	if env.LmdbEnv != lmdbEnv {
+		t.Fatal("LmdbEnv is not the provided lmdb.Env")
+	}
+	a := env.GetDatabase("a")
+	mustPut(t, a, "k", []byte("v"))
+	if got := mustGet(t, a, "k"); got != "v" {
+		t.Fatalf("value = %q", got)
+	}
+	if err := env.GetDatabase("b").PutWithTTL([]byte("k"), []byte("v"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPeek(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	mustPut(t, db, "k", []byte("hello world"))
+	var words int
+	err := db.Peek([]byte("k"), func(value []byte) error {
+		words = len(bytes.Fields(value))
+		return nil
+	})
+	if err != nil || words != 2 {
+		t.Fatalf("words = %d, %v, want 2", words, err)
+	}
+	called := false
+	err = db.Peek([]byte("absent"), func(value []byte) error {
+		called = true
+		return nil
+	})
+	if err != ErrNotFound || called {
+		t.Fatalf("absent key: %v, fn called %v", err, called)
+	}
+	errFn := errors.New("fn failed")
+	if err := db.Peek([]byte("k"), func([]byte) error { return errFn }); err != errFn {
+		t.Fatalf("err = %v, want the error of fn", err)
+	}
+
+	value := make([]byte, 4096)
+	mustPut(t, db, "large", value)
+	get := testing.AllocsPerRun(100, func() {
+		db.Get([]byte("large"))
+	})
+	peek := testing.AllocsPerRun(100, func() {
+		db.Peek([]byte("large"), func([]byte) error { return nil })
+	})
+	if peek >= get {
+		t.Fatalf("Peek allocates %v times per call, Get %v", peek, get)
+	}
+}
+
+func BenchmarkGet(b *testing.B) {
+	db := newTestEnv(b, DbConfig{DbName: "a"}).GetDatabase("a")
+	mustPut(b, db, "k", make([]byte, 4096))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := db.Get([]byte("k")); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPeek(b *testing.B) {
+	db := newTestEnv(b, DbConfig{DbName: "a"}).GetDatabase("a")
+	mustPut(b, db, "k", make([]byte, 4096))
+	var sum int
+	fn := func(value []byte) error {
+		sum += int(value[0])
+		return nil
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := db.Peek([]byte("k"), fn); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestSyncInterval(t *testing.T) {
+	var syncs int64
+	defer func(sync func(*lmdb.Env)) { periodicSync = sync }(periodicSync)
+	periodicSync = func(lmdbEnv *lmdb.Env) {
+		atomic.AddInt64(&syncs, 1)
+		lmdbEnv.Sync(true)
+	}
+	config := DefaultLmdbConfig
+	config.Databases = []DbConfig{{DbName: "a"}}
+	config.SyncInterval = 5 * time.Millisecond
+	config.OpenPath = t.TempDir()
+	env, err := NewLmdb(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustPut(t, env.GetDatabase("a"), "k", []byte("v"))
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt64(&syncs) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d periodic syncs, want at least 2", atomic.LoadInt64(&syncs))
+		}
+		time.Sleep(time.Millisecond)
+	}
+	env.Close()
+	// the ticker stops with the updater goroutine
+	stopped := atomic.LoadInt64(&syncs)
+	time.Sleep(20 * time.Millisecond)
+	if n := atomic.LoadInt64(&syncs); n != stopped {
+		t.Fatalf("%d syncs after Close", n-stopped)
+	}
+}
+
+func TestCloseStopsUpdater(t *testing.T) {
+	config := DefaultLmdbConfig
+	config.Databases = []DbConfig{{DbName: "a"}}
+	config.OpenPath = t.TempDir()
+	env, err := NewLmdb(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustPut(t, env.GetDatabase("a"), "k", []byte("v"))
+	closed := make(chan struct{})
+	go func() {
+		env.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not return")
+	}
+	// closing again is a no-op
+	env.Close()
+}
+
+func TestPutAppendDup(t *testing.T) {
+	env := newTestEnv(t, DbConfig{DbName: "dups", Flags: lmdb.DupSort | lmdb.DupFixed}, DbConfig{DbName: "plain"})
+	db := env.GetDatabase("dups")
+	for _, v := range []string{"a", "b", "c"} {
+		if err := db.PutAppendDup([]byte("k"), []byte(v)); err != nil {
+			t.Fatalf("append %s: %v", v, err)
+		}
+	}
+	err := db.PutAppendDup([]byte("k"), []byte("b"))
+	if !lmdb.IsErrno(err, lmdb.KeyExist) {
+		t.Fatalf("out of order: %v, want KeyExist", err)
+	}
+	values, err := db.GetMultiple([]byte("k"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(bytes.Join(values, nil)); got != "abc" {
+		t.Fatalf("duplicates = %q, want abc", got)
+	}
+	if err := env.GetDatabase("plain").PutAppendDup([]byte("k"), []byte("a")); err == nil {
+		t.Fatal("PutAppendDup succeeded on a database without DupSort")
+	}
+}
+
+func TestGetMeta(t *testing.T) {
+	env := newTestEnv(t, DbConfig{DbName: "a"})
+	db := env.GetDatabase("a")
+	mustPut(t, db, "k", make([]byte, 300))
+	value, meta, err := db.GetMeta([]byte("k"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Size != len(value) || meta.Size != 300 {
+		t.Fatalf("Size = %d for a value of %d bytes", meta.Size, len(value))
+	}
+	last, err := env.LastTxnID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.TxnID != last {
+		t.Fatalf("TxnID = %d, want the last committed %d", meta.TxnID, last)
+	}
+	if _, _, err := db.GetMeta([]byte("absent")); err != ErrNotFound {
+		t.Fatalf("absent: %v, want ErrNotFound", err)
+	}
+}
+
+func TestUpdateTxnReadsOwnWrites(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	mustPut(t, db, "counter", []byte{1})
+	err := db.UpdateTxn(func(txn *lmdb.Txn) error {
+		for i := 0; i < 3; i++ {
+			b, err := txn.Get(db.dbi, []byte("counter"))
+			if err != nil {
+				return err
+			}
+			// copied before writing, as b points into the transaction
+			next := []byte{b[0] + 1}
+			err = txn.Put(db.dbi, []byte("counter"), next, 0)
+			if err != nil {
+				return err
+			}
+		}
+		b, err := txn.Get(db.dbi, []byte("counter"))
+		if err != nil {
+			return err
+		}
+		if b[0] != 4 {
+			t.Errorf("uncommitted counter = %d, want 4", b[0])
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := mustGet(t, db, "counter"); got != "\x04" {
+		t.Fatalf("committed counter = %q, want 4", got)
+	}
+}
+
+func TestSyncWrites(t *testing.T) {
+	config := DefaultLmdbConfig
+	config.Databases = []DbConfig{{DbName: "a"}}
+	config.SyncWrites = true
+	config.OpenPath = t.TempDir()
+	env, err := NewLmdb(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := env.GetDatabase("a")
+	done := make(chan error)
+	for i := 0; i < 4; i++ {
+		go func(i int) {
+			done <- db.Put([]byte{byte('a' + i)}, []byte("v"))
+		}(i)
+	}
+	for i := 0; i < 4; i++ {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if keys := keysOf(t, db); len(keys) != 4 {
+		t.Fatalf("keys = %v", keys)
+	}
+	closed := make(chan struct{})
+	go func() {
+		env.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close waited for an updater goroutine that is not running")
+	}
+}
+
+func TestGetOrDefault(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	mustPut(t, db, "k", []byte("stored"))
+	b, err := db.GetOrDefault([]byte("k"), []byte("default"))
+	if err != nil || string(b) != "stored" {
+		t.Fatalf("present: %q, %v", b, err)
+	}
+	b, err = db.GetOrDefault([]byte("absent"), []byte("default"))
+	if err != nil || string(b) != "default" {
+		t.Fatalf("absent: %q, %v", b, err)
+	}
+	if _, err := db.GetOrDefault([]byte{}, []byte("default")); err == nil {
+		t.Fatal("empty key returned the default instead of an error")
+	}
+}
+
+func TestCompactOnClose(t *testing.T) {
+	config := DefaultLmdbConfig
+	config.Databases = []DbConfig{{DbName: "a"}}
+	config.OpenPath = t.TempDir()
+	config.CompactOnClose = filepath.Join(t.TempDir(), "compact")
+	for run := 0; run < 2; run++ {
+		env, err := NewLmdb(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		db := env.GetDatabase("a")
+		for i := 0; i < 2000; i++ {
+			mustPut(t, db, fmt.Sprintf("%d/%05d", run, i), make([]byte, 512))
+		}
+		if _, err := db.DeleteWhere(nil, nil, func(key, value []byte) bool { return key[len(key)-1] != '0' }); err != nil {
+			t.Fatal(err)
+		}
+		env.Close()
+		// a later Close replaces the copy written by the previous one
+		if err := env.CloseErr(); err != nil {
+			t.Fatalf("run %d: %v", run, err)
+		}
+		original, err := os.Stat(filepath.Join(config.OpenPath, "data.mdb"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		compacted, err := os.Stat(filepath.Join(config.CompactOnClose, "data.mdb"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if compacted.Size() >= original.Size() {
+			t.Fatalf("run %d: compacted %d bytes, original %d", run, compacted.Size(), original.Size())
+		}
+	}
+
+	// the copy is a usable environment holding the entries left by both runs
+	config.OpenPath = config.CompactOnClose
+	config.CompactOnClose = ""
+	env, err := NewLmdb(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.Close()
+	count, err := env.GetDatabase("a").CountWhere(nil, nil, func(key, value []byte) bool { return true })
+	if err != nil || count != 400 {
+		t.Fatalf("compacted copy holds %d entries, %v, want 400", count, err)
+	}
+}
+
+func TestCompactNoSubdir(t *testing.T) {
+	config := DefaultLmdbConfig
+	config.Databases = []DbConfig{{DbName: "a"}}
+	config.OpenPath = filepath.Join(t.TempDir(), "store.mdb")
+	config.OpenFlag |= lmdb.NoSubdir
+	config.CompactOnClose = filepath.Join(t.TempDir(), "nested", "compact.mdb")
+	copyTo := filepath.Join(t.TempDir(), "nested", "copy.mdb")
+	for run := 0; run < 2; run++ {
+		env, err := NewLmdb(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mustPut(t, env.GetDatabase("a"), fmt.Sprintf("k%d", run), []byte("v"))
+		if run == 0 {
+			if err := env.CompactTo(copyTo); err != nil {
+				t.Fatalf("CompactTo: %v", err)
+			}
+		}
+		env.Close()
+		// a later Close replaces the copy written by the previous one
+		if err := env.CloseErr(); err != nil {
+			t.Fatalf("run %d: %v", run, err)
+		}
+	}
+
+	// both copies are data files of usable environments
+	copies := map[string]uint64{copyTo: 1, config.CompactOnClose: 2}
+	config.CompactOnClose = ""
+	for path, want := range copies {
+		if info, err := os.Stat(path); err != nil || info.IsDir() {
+			t.Fatalf("copy %s = %v, %v, want a file", path, info, err)
+		}
+		config.OpenPath = path
+		env, err := NewLmdb(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		count, err := env.GetDatabase("a").CountWhere(nil, nil, func(key, value []byte) bool { return true })
+		env.Close()
+		if err != nil || count != want {
+			t.Fatalf("copy %s holds %d entries, %v, want %d", path, count, err, want)
+		}
+	}
+}
+
+func TestGetMultiple(t *testing.T) {
+	env := newTestEnv(t, DbConfig{DbName: "dups", Flags: lmdb.DupSort | lmdb.DupFixed}, DbConfig{DbName: "plain", Flags: lmdb.DupSort})
+	db := env.GetDatabase("dups")
+	// enough 8 byte duplicates to span several pages
+	const n = 3000
+	dup := func(i int) []byte {
+		b := make([]byte, 8)
+		binary.BigEndian.PutUint64(b, uint64(i))
+		return b
+	}
+	err := db.UpdateTxn(func(txn *lmdb.Txn) error {
+		for i := n - 1; i >= 0; i-- {
+			if err := txn.Put(db.dbi, []byte("k"), dup(i), 0); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := db.GetMultiple([]byte("k"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != n {
+		t.Fatalf("read %d duplicates, want %d", len(values), n)
+	}
+	for i, v := range values {
+		if !bytes.Equal(v, dup(i)) {
+			t.Fatalf("duplicate %d = %x", i, v)
+		}
+	}
+	if _, err := db.GetMultiple([]byte("absent")); err != ErrNotFound {
+		t.Fatalf("absent: %v, want ErrNotFound", err)
+	}
+	if _, err := env.GetDatabase("plain").GetMultiple([]byte("k")); err == nil {
+		t.Fatal("GetMultiple succeeded on a database without DupFixed")
+	}
+	ro, err := db.ReadOnly().GetMultiple([]byte("k"))
+	if err != nil || len(ro) != n {
+		t.Fatalf("ReadOnlyDb.GetMultiple read %d, %v", len(ro), err)
+	}
+}
+
+func TestAliasDatabase(t *testing.T) {
+	env := newTestEnv(t, DbConfig{DbName: "users_v1"}, DbConfig{DbName: "other"})
+	if err := env.AliasDatabase("users_v1", "users"); err != nil {
+		t.Fatal(err)
+	}
+	mustPut(t, env.GetDatabase("users_v1"), "alice", []byte("v1"))
+	if got := mustGet(t, env.GetDatabase("users"), "alice"); got != "v1" {
+		t.Fatalf("alias reads %q", got)
+	}
+	mustPut(t, env.GetDatabase("users"), "bob", []byte("v1"))
+	if got := mustGet(t, env.GetDatabase("users_v1"), "bob"); got != "v1" {
+		t.Fatalf("existing name reads %q", got)
+	}
+	if err := env.AliasDatabase("missing", "x"); err == nil {
+		t.Fatal("aliased a database that does not exist")
+	}
+	if err := env.AliasDatabase("users_v1", "other"); err == nil {
+		t.Fatal("alias replaced an existing database")
+	}
+	if summary, err := env.Summary(); err != nil || len(summary) != 2 {
+		t.Fatalf("summary of %d databases, %v, want the alias left out", len(summary), err)
+	}
+}
+
+func TestGetAllInto(t *testing.T) {
+	type user struct {
+		Name  string
+		Email string
+	}
+	type order struct {
+		ID    int
+		Total float64
+	}
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	mustPut(t, db, "user", user{Name: "ann", Email: "ann@example.com"})
+	mustPut(t, db, "order", order{ID: 7, Total: 9.5})
+	mustPut(t, db, "record", testRecord{ID: 1, Name: "one"})
+
+	var u user
+	var o order
+	var r testRecord
+	keys := [][]byte{[]byte("user"), []byte("order"), []byte("record")}
+	if err := db.GetAllInto(keys, []interface{}{&u, &o, &r}); err != nil {
+		t.Fatal(err)
+	}
+	if u != (user{Name: "ann", Email: "ann@example.com"}) || o != (order{ID: 7, Total: 9.5}) || r != (testRecord{ID: 1, Name: "one"}) {
+		t.Fatalf("decoded %+v, %+v, %+v", u, o, r)
+	}
+
+	// the first failure is returned while the other keys are still decoded
+	var u2 user
+	missing, missing2 := testRecord{ID: -1}, testRecord{ID: -2}
+	err := db.ReadOnly().GetAllInto([][]byte{[]byte("absent"), []byte("user"), []byte("absent2")}, []interface{}{&missing, &u2, &missing2})
+	if !errors.Is(err, ErrNotFound) || err.Error() != `key "absent": `+ErrNotFound.Error()+" (and 1 more)" {
+		t.Fatalf("err = %v, want ErrNotFound for key absent and 1 more", err)
+	}
+	if missing.ID != -1 || missing2.ID != -2 || u2.Name != "ann" {
+		t.Fatalf("decoded %+v, %+v, %+v", missing, u2, missing2)
+	}
+
+	if err := db.GetAllInto(keys, []interface{}{&u}); err == nil {
+		t.Fatal("mismatched lengths returned no error")
+	}
+}
+
+func TestDropAll(t *testing.T) {
+	env := newTestEnv(t, DbConfig{DbName: "a"}, DbConfig{DbName: "b"}, DbConfig{DbName: "cache", TTL: true})
+	a, b, cache := env.GetDatabase("a"), env.GetDatabase("b"), env.GetDatabase("cache")
+	mustPut(t, a, "k", []byte("v"))
+	mustPut(t, b, "k", []byte("v"))
+	if err := cache.PutWithTTL([]byte("k"), []byte("v"), 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.DropAll(); err != nil {
+		t.Fatal(err)
+	}
+	for i, db := range []*Db{a, b, cache} {
+		if keys := keysOf(t, db); len(keys) != 0 {
+			t.Fatalf("db %d after DropAll: %v", i, keys)
+		}
+	}
+	// the databases stay usable, and the dropped expiry does not apply to a new value
+	mustPut(t, a, "k", []byte("new"))
+	mustPut(t, cache, "k", []byte("new"))
+	time.Sleep(20 * time.Millisecond)
+	if got := mustGet(t, a, "k"); got != "new" {
+		t.Fatalf("a after DropAll = %q", got)
+	}
+	if got := mustGet(t, cache, "k"); got != "new" {
+		t.Fatalf("cache after DropAll = %q", got)
+	}
+}
+
+func TestPutSized(t *testing.T) {
+	jsonCodec := Codec{Marshal: json.Marshal, Unmarshal: json.Unmarshal}
+	env := newTestEnv(t, DbConfig{DbName: "a"}, DbConfig{DbName: "tagged", Codecs: map[byte]Codec{1: jsonCodec}, CodecTag: 1})
+	a, tagged := env.GetDatabase("a"), env.GetDatabase("tagged")
+	for _, c := range []struct {
+		db    *Db
+		name  string
+		key   string
+		value interface{}
+	}{
+		{a, "a", "raw", []byte("twelve bytes")},
+		{a, "a", "struct", testRecord{ID: 1, Name: "one"}},
+		{tagged, "tagged", "struct", testRecord{ID: 1, Name: "one"}},
+	} {
+		size, err := c.db.PutSized([]byte(c.key), c.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored := len(mustGet(t, c.db, c.key)); size != stored {
+			t.Fatalf("%s/%s: reported %d bytes, stored %d", c.name, c.key, size, stored)
+		}
+	}
+	if size, _ := a.PutSized([]byte("raw"), []byte("twelve bytes")); size != 12 {
+		t.Fatalf("raw size = %d, want 12", size)
+	}
+	if size, err := a.PutSized([]byte("bad"), make(chan int)); err == nil || size != 0 {
+		t.Fatalf("unmarshalable value = %d, %v", size, err)
+	}
+}
+
+func TestReadsDuringLongWrite(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	mustPut(t, db, "k", []byte("old"))
+	written, release := make(chan struct{}), make(chan struct{})
+	// released on every exit, so the Close of the cleanup does not wait behind the write
+	var releaseOnce sync.Once
+	releaseWrite := func() { releaseOnce.Do(func() { close(release) }) }
+	defer releaseWrite()
+	done := make(chan error, 1)
+	go func() {
+		done <- db.UpdateTxn(func(txn *lmdb.Txn) error {
+			if err := txn.Put(db.dbi, []byte("k"), []byte("new"), 0); err != nil {
+				return err
+			}
+			close(written)
+			<-release
+			return nil
+		})
+	}()
+	<-written
+	// the write transaction is open and holds the updater goroutine
+	for i := 0; i < 10; i++ {
+		read := make(chan string)
+		go func() {
+			b, _ := db.Get([]byte("k"))
+			read <- string(b)
+		}()
+		select {
+		case got := <-read:
+			if got != "old" {
+				t.Fatalf("read during the write = %q, want old", got)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("read blocked behind the write transaction")
+		}
+	}
+	releaseWrite()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if got := mustGet(t, db, "k"); got != "new" {
+		t.Fatalf("after the write = %q, want new", got)
+	}
+}
+
+func TestCreateDirs(t *testing.T) {
+	config := DefaultLmdbConfig
+	config.Databases = []DbConfig{{DbName: "a"}}
+	config.OpenPath = filepath.Join(t.TempDir(), "nested", "store")
+	if env, err := NewLmdb(config); err == nil {
+		env.Close()
+		t.Fatal("opened a missing path without CreateDirs")
+	}
+	if _, err := os.Stat(config.OpenPath); !os.IsNotExist(err) {
+		t.Fatalf("path created without CreateDirs: %v", err)
+	}
+
+	config.CreateDirs = true
+	config.DirMode = 0700
+	env, err := NewLmdb(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env.Close()
+	mustPut(t, env.GetDatabase("a"), "k", []byte("v"))
+	info, err := os.Stat(config.OpenPath)
+	if err != nil || !info.IsDir() || info.Mode().Perm() != 0700 {
+		t.Fatalf("created %v, %v, want a 0700 directory", info.Mode(), err)
+	}
+
+	// with NoSubdir only the parent of OpenPath is created
+	config.OpenPath = filepath.Join(t.TempDir(), "nested", "store.mdb")
+	config.OpenFlag |= lmdb.NoSubdir
+	env2, err := NewLmdb(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer env2.Close()
+	if info, err := os.Stat(config.OpenPath); err != nil || info.IsDir() {
+		t.Fatalf("NoSubdir OpenPath = %v, %v, want a file", info, err)
+	}
+}
+
+// appendTestRecord is a DbConfig.MarshalAppend encoding testRecord as "ID:Name"
+func appendTestRecord(dst []byte, v interface{}) ([]byte, error) {
+	rec, ok := v.(testRecord)
+	if !ok {
+		return nil, fmt.Errorf("unsupported type %T", v)
+	}
+	dst = strconv.AppendInt(dst, int64(rec.ID), 10)
+	dst = append(dst, ':')
+	return append(dst, rec.Name...), nil
+}
+
+// marshalTestRecord is appendTestRecord allocating a new buffer
+func marshalTestRecord(v interface{}) ([]byte, error) {
+	return appendTestRecord(nil, v)
+}
+
+func TestMarshalAppend(t *testing.T) {
+	appending := DbConfig{DbName: "appending", Marshal: marshalTestRecord, MarshalAppend: appendTestRecord}
+	env := newTestEnv(t, appending, DbConfig{DbName: "plain", Marshal: marshalTestRecord})
+	db := env.GetDatabase("appending")
+	mustPut(t, db, "long", testRecord{ID: 1, Name: "a longer name"})
+	// a shorter value reusing the write buffer does not change the earlier value
+	mustPut(t, db, "short", testRecord{ID: 2, Name: "b"})
+	if got := mustGet(t, db, "long"); got != "1:a longer name" {
+		t.Fatalf("long = %q", got)
+	}
+	if got := mustGet(t, db, "short"); got != "2:b" {
+		t.Fatalf("short = %q", got)
+	}
+	if err := db.Put([]byte("bad"), "not a record"); err == nil {
+		t.Fatal("MarshalAppend error was not returned")
+	}
+
+	// without MarshalAppend, and with SyncWrites, Marshal is used
+	mustPut(t, env.GetDatabase("plain"), "k", testRecord{ID: 3, Name: "c"})
+	if got := mustGet(t, env.GetDatabase("plain"), "k"); got != "3:c" {
+		t.Fatalf("plain = %q", got)
+	}
+	config := DefaultLmdbConfig
+	config.Databases = []DbConfig{appending}
+	config.SyncWrites = true
+	db = newTestEnvConfig(t, config).GetDatabase("appending")
+	mustPut(t, db, "k", testRecord{ID: 4, Name: "d"})
+	if got := mustGet(t, db, "k"); got != "4:d" {
+		t.Fatalf("SyncWrites = %q", got)
+	}
+}
+
+func benchmarkPutRecord(b *testing.B, dbConfig DbConfig) {
+	db := newTestEnv(b, dbConfig).GetDatabase(dbConfig.DbName)
+	rec := testRecord{ID: 1, Name: string(make([]byte, 1024))}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := db.Put([]byte("k"), rec); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPutMarshal(b *testing.B) {
+	benchmarkPutRecord(b, DbConfig{DbName: "a", Marshal: marshalTestRecord})
+}
+
+func BenchmarkPutMarshalAppend(b *testing.B) {
+	benchmarkPutRecord(b, DbConfig{DbName: "a", Marshal: marshalTestRecord, MarshalAppend: appendTestRecord})
+}
+
+func TestGetAndMarshalMap(t *testing.T) {
+	env := newTestEnv(t, DbConfig{DbName: "array"}, DbConfig{DbName: "map", MsgpackMapMode: true})
+	array, mapMode := env.GetDatabase("array"), env.GetDatabase("map")
+
+	mustPut(t, array, "struct", testRecord{ID: 1, Name: "one"})
+	var rec testRecord
+	if err := array.GetAndMarshal([]byte("struct"), &rec); err != nil || rec != (testRecord{ID: 1, Name: "one"}) {
+		t.Fatalf("struct = %+v, %v", rec, err)
+	}
+	mustPut(t, array, "map", map[string]interface{}{"Name": "two"})
+	var m map[string]interface{}
+	if err := array.GetAndMarshal([]byte("map"), &m); err != nil || m["Name"] != "two" {
+		t.Fatalf("map = %v, %v", m, err)
+	}
+	// an array-encoded struct has no field names to decode into a map
+	m = nil
+	if err := array.GetAndMarshal([]byte("struct"), &m); err == nil {
+		t.Fatalf("array-encoded struct decoded into the map %v", m)
+	}
+
+	mustPut(t, mapMode, "struct", testRecord{ID: 3, Name: "three"})
+	m = nil
+	if err := mapMode.GetAndMarshal([]byte("struct"), &m); err != nil || m["Name"] != "three" || fmt.Sprint(m["ID"]) != "3" {
+		t.Fatalf("MsgpackMapMode struct into a map = %v, %v", m, err)
+	}
+	rec = testRecord{}
+	if err := mapMode.GetAndMarshal([]byte("struct"), &rec); err != nil || rec != (testRecord{ID: 3, Name: "three"}) {
+		t.Fatalf("MsgpackMapMode struct = %+v, %v", rec, err)
+	}
+}
+
+func TestMemoryOnly(t *testing.T) {
+	config := DefaultLmdbConfig
+	config.Databases = []DbConfig{{DbName: "a"}}
+	config.OpenPath = filepath.Join(t.TempDir(), "ignored")
+	config.MemoryOnly = true
+	env, err := NewLmdb(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := env.tempDir
+	if filepath.Dir(dir) != memoryOnlyDir() {
+		env.Close()
+		t.Fatalf("opened in %s, want a directory inside %s", dir, memoryOnlyDir())
+	}
+	mustPut(t, env.GetDatabase("a"), "k", []byte("v"))
+	if got := mustGet(t, env.GetDatabase("a"), "k"); got != "v" {
+		t.Fatalf("value = %q", got)
+	}
+	if _, err := os.Stat(config.OpenPath); !os.IsNotExist(err) {
+		t.Fatalf("OpenPath was used: %v", err)
+	}
+	env.Close()
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatalf("temporary directory left after Close: %v", err)
+	}
+}
+
+func ExampleLmdbEnvConfig_memoryOnly() {
+	config := DefaultLmdbConfig
+	config.Databases = []DbConfig{{DbName: "users"}}
+	config.MemoryOnly = true
+	env, err := NewLmdb(config)
+	if err != nil {
+		panic(err)
+	}
+	// Close removes the temporary directory
+	defer env.Close()
+
+	users := env.GetDatabase("users")
+	if err := users.Put([]byte("ann"), []byte("admin")); err != nil {
+		panic(err)
+	}
+	role, err := users.Get([]byte("ann"))
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(string(role))
+	// Output: admin
+}
+
+func TestDbCompact(t *testing.T) {
+	env := newTestEnv(t, DbConfig{DbName: "a", TTL: true}, DbConfig{DbName: "dups", Flags: lmdb.DupSort | lmdb.DupFixed})
+	db := env.GetDatabase("a")
+	// bloat the database with random order writes and scattered deletes
+	value := bytes.Repeat([]byte("x"), 100)
+	err := env.Transaction(func(tx *Tx) error {
+		for _, i := range rand.New(rand.NewSource(1)).Perm(4000) {
+			if err := tx.Put(db, []byte(fmt.Sprintf("%05d", i)), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4000; i++ {
+		if i%4 == 0 {
+			continue
+		}
+		if err := db.Del([]byte(fmt.Sprintf("%05d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.PutWithTTL([]byte("expiring"), []byte("v"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	before, err := env.Summary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keysBefore := keysOf(t, db)
+
+	if err := db.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	after, err := env.Summary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after["a"].Entries != before["a"].Entries || after["a"].ApproxBytes >= before["a"].ApproxBytes {
+		t.Fatalf("compacted %+v into %+v, want the same entries in fewer pages", before["a"], after["a"])
+	}
+	if fmt.Sprint(keysOf(t, db)) != fmt.Sprint(keysBefore) {
+		t.Fatal("keys changed by Compact")
+	}
+	if got := mustGet(t, db, "00400"); got != string(value) {
+		t.Fatalf("00400 = %q", got)
+	}
+	if _, remaining, err := db.GetWithExpiry([]byte("expiring")); err != nil || remaining <= 59*time.Minute {
+		t.Fatalf("expiry after Compact = %v, %v", remaining, err)
+	}
+
+	// the duplicates of a lmdb.DupSort key are kept
+	dups := env.GetDatabase("dups")
+	for _, v := range []string{"c", "a", "b"} {
+		if err := dups.PutFlags([]byte("k"), []byte(v), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := dups.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	values, err := dups.GetMultiple([]byte("k"))
+	if err != nil || fmt.Sprintf("%s", values) != "[a b c]" {
+		t.Fatalf("duplicates after Compact = %s, %v", values, err)
+	}
+}
+
+// flateCodec is a Codec compressing msgpack encoded values
+var flateCodec = Codec{
+	Marshal: func(v interface{}) ([]byte, error) {
+		b, err := MsgpackArrayCodec.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		w, _ := flate.NewWriter(&buf, flate.BestCompression)
+		w.Write(b)
+		err = w.Close()
+		return buf.Bytes(), err
+	},
+	Unmarshal: func(data []byte, v interface{}) error {
+		b, err := io.ReadAll(flate.NewReader(bytes.NewReader(data)))
+		if err != nil {
+			return err
+		}
+		return MsgpackArrayCodec.Unmarshal(b, v)
+	},
+}
+
+func TestGetRaw(t *testing.T) {
+	env := newTestEnv(t, DbConfig{DbName: "compressed", Codecs: map[byte]Codec{1: flateCodec}, CodecTag: 1},
+		DbConfig{DbName: "cache", TTL: true})
+	db := env.GetDatabase("compressed")
+	rec := testRecord{ID: 1, Name: strings.Repeat("compressible ", 100)}
+	mustPut(t, db, "rec", rec)
+
+	raw, err := db.ReadOnly().GetRaw([]byte("rec"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, _ := MsgpackArrayCodec.Marshal(rec)
+	if raw[0] != 1 || len(raw) >= len(plain) {
+		t.Fatalf("GetRaw returned %d bytes with tag %d, want the tagged compressed %d bytes", len(raw), raw[0], len(plain))
+	}
+	var decoded testRecord
+	if err := flateCodec.Unmarshal(raw[1:], &decoded); err != nil || decoded != rec {
+		t.Fatalf("raw bytes do not decompress to the value: %v", err)
+	}
+	decoded = testRecord{}
+	if err := db.GetAndMarshal([]byte("rec"), &decoded); err != nil || decoded != rec {
+		t.Fatalf("GetAndMarshal = %v, want the decompressed value", err)
+	}
+	if _, err := db.GetRaw([]byte("absent")); err != ErrNotFound {
+		t.Fatalf("absent key: %v, want ErrNotFound", err)
+	}
+
+	// expired keys not yet purged are still returned
+	cache := env.GetDatabase("cache")
+	if err := cache.PutWithTTL([]byte("k"), []byte("v"), time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if _, err := cache.Get([]byte("k")); err != ErrNotFound {
+		t.Fatalf("Get of an expired key: %v, want ErrNotFound", err)
+	}
+	if b, err := cache.GetRaw([]byte("k")); err != nil || string(b) != "v" {
+		t.Fatalf("GetRaw of an expired key = %q, %v", b, err)
+	}
+}
@@ -0,0 +1,76 @@
+//go:build unix
+
+package lmdbstore
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestHoldLock is run as a separate process by TestOpenTimeout,
+// holding the exclusive lock lmdb takes on lock.mdb until stdin is closed
+func TestHoldLock(t *testing.T) {
+	path := os.Getenv("LMDBSTORE_HOLD_LOCK")
+	if path == "" {
+		t.Skip("only run by TestOpenTimeout")
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	lock := syscall.Flock_t{Type: syscall.F_WRLCK, Whence: 0, Start: 0, Len: 1}
+	if err := syscall.FcntlFlock(f.Fd(), syscall.F_SETLKW, &lock); err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout.WriteString("locked\n")
+	bufio.NewReader(os.Stdin).ReadString('\n')
+}
+
+func TestOpenTimeout(t *testing.T) {
+	// not t.TempDir, the timed out open may still be creating files when the test ends
+	dir, err := os.MkdirTemp("", "lmdbstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	holder := exec.Command(os.Args[0], "-test.run=^TestHoldLock$")
+	holder.Env = append(os.Environ(), "LMDBSTORE_HOLD_LOCK="+filepath.Join(dir, "lock.mdb"))
+	stdin, err := holder.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := holder.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := holder.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer holder.Wait()
+	defer stdin.Close()
+	if line, err := bufio.NewReader(stdout).ReadString('\n'); err != nil || line != "locked\n" {
+		t.Fatalf("lock holder: %q, %v", line, err)
+	}
+
+	config := DefaultLmdbConfig
+	config.Databases = []DbConfig{{DbName: "a"}}
+	config.OpenPath = dir
+	config.OpenTimeout = 50 * time.Millisecond
+	start := time.Now()
+	env, err := NewLmdb(config)
+	if err != ErrOpenTimeout {
+		if env != nil {
+			env.Close()
+		}
+		t.Fatalf("err = %v, want ErrOpenTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("returned after %v", elapsed)
+	}
+}
@@ -0,0 +1,40 @@
+package lmdbstore
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/bmatsuo/lmdb-go/lmdb"
+)
+
+// ErrAlreadyLocked is returned by NewLmdb with LmdbEnvConfig.SingleWriter
+// when another LmdbEnv, in this or another process, holds the writer lock of the path
+var ErrAlreadyLocked = errors.New("lmdb environment is locked by another writer")
+
+// writerLockPath returns the path of the writer lock file,
+// next to LMDB's own lock file
+func writerLockPath(config LmdbEnvConfig) string {
+	if config.OpenFlag&lmdb.NoSubdir != 0 {
+		return config.OpenPath + "-writer.lock"
+	}
+	return filepath.Join(config.OpenPath, "writer.lock")
+}
+
+// lockWriter opens the lock file at path and takes an exclusive advisory lock on it without waiting
+//
+// The lock is released by closing the returned file
+//
+func lockWriter(path string, mode fs.FileMode) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, mode)
+	if err != nil {
+		return nil, err
+	}
+	err = lockFile(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
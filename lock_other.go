@@ -0,0 +1,13 @@
+//go:build !unix && !windows
+
+package lmdbstore
+
+import (
+	"errors"
+	"os"
+)
+
+// lockFile is not supported on this platform
+func lockFile(f *os.File) error {
+	return errors.New("LmdbEnvConfig.SingleWriter is not supported on this platform")
+}
@@ -0,0 +1,30 @@
+package lmdbstore
+
+import (
+	"testing"
+)
+
+func TestSingleWriter(t *testing.T) {
+	config := DefaultLmdbConfig
+	config.Databases = []DbConfig{{DbName: "a"}}
+	config.OpenPath = t.TempDir()
+	config.SingleWriter = true
+	first, err := NewLmdb(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second, err := NewLmdb(config); err != ErrAlreadyLocked {
+		if second != nil {
+			second.Close()
+		}
+		first.Close()
+		t.Fatalf("second writer: %v, want ErrAlreadyLocked", err)
+	}
+	first.Close()
+	// Close releases the lock
+	again, err := NewLmdb(config)
+	if err != nil {
+		t.Fatalf("after Close: %v", err)
+	}
+	again.Close()
+}
@@ -0,0 +1,17 @@
+//go:build unix
+
+package lmdbstore
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive flock on f, returning ErrAlreadyLocked if it is held elsewhere
+func lockFile(f *os.File) error {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return ErrAlreadyLocked
+	}
+	return err
+}
@@ -0,0 +1,62 @@
+package lmdbstore
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"syscall"
+
+	"github.com/bmatsuo/lmdb-go/lmdb"
+)
+
+// ErrMapSizeTooLarge is returned by NewLmdb when LmdbEnvConfig.MapSize cannot be mapped
+// into the address space of the process
+var ErrMapSizeTooLarge = errors.New("map size exceeds the available address space")
+
+// defaultMapSize is the MapSize of DefaultLmdbConfig,
+// 1 GiB on 64-bit platforms and 256 MiB on 32-bit platforms
+var defaultMapSize = platformMapSize(strconv.IntSize)
+
+// maxMapSize is the largest MapSize the size_t of the platform can hold
+var maxMapSize = maxPlatformMapSize(strconv.IntSize)
+
+// platformMapSize returns the default MapSize for a platform with intSize bit integers
+func platformMapSize(intSize int) int64 {
+	if intSize == 32 {
+		return 256 << 20
+	}
+	return 1 << 30
+}
+
+// maxPlatformMapSize returns the largest MapSize for a platform with intSize bit integers
+func maxPlatformMapSize(intSize int) int64 {
+	if intSize == 32 {
+		return math.MaxUint32
+	}
+	return math.MaxInt64
+}
+
+// checkMapSize returns ErrMapSizeTooLarge if size does not fit in a size_t,
+// which lmdb would otherwise silently truncate
+func checkMapSize(size int64) error {
+	if size > maxMapSize {
+		return mapSizeError(size)
+	}
+	return nil
+}
+
+// mapOpenError returns ErrMapSizeTooLarge if err is the failure to map size bytes
+// into the address space on open, otherwise err
+func mapOpenError(err error, size int64) error {
+	if lmdb.IsErrnoSys(err, syscall.ENOMEM) {
+		return fmt.Errorf("%w: %v", mapSizeError(size), err)
+	}
+	return err
+}
+
+// mapSizeError wraps ErrMapSizeTooLarge with a suggestion of a smaller MapSize
+func mapSizeError(size int64) error {
+	return fmt.Errorf("%w: MapSize %d could not be mapped, try a smaller MapSize such as %d",
+		ErrMapSizeTooLarge, size, platformMapSize(32))
+}
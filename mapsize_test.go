@@ -0,0 +1,53 @@
+package lmdbstore
+
+import (
+	"errors"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/bmatsuo/lmdb-go/lmdb"
+)
+
+func TestPlatformMapSize(t *testing.T) {
+	if got := platformMapSize(32); got != 256<<20 {
+		t.Fatalf("32-bit default = %d, want 256 MiB", got)
+	}
+	if got := platformMapSize(64); got != 1<<30 {
+		t.Fatalf("64-bit default = %d, want 1 GiB", got)
+	}
+	if got := maxPlatformMapSize(32); got != 1<<32-1 {
+		t.Fatalf("32-bit maximum = %d", got)
+	}
+}
+
+func TestMapSizeTooLarge(t *testing.T) {
+	// simulate the size_t of a 32-bit platform
+	saved := maxMapSize
+	maxMapSize = maxPlatformMapSize(32)
+	defer func() { maxMapSize = saved }()
+
+	config := DefaultLmdbConfig
+	config.Databases = []DbConfig{{DbName: "a"}}
+	config.OpenPath = t.TempDir()
+	config.MapSize = 1 << 33
+	env, err := NewLmdb(config)
+	if err == nil {
+		env.Close()
+		t.Fatal("opened with a MapSize past the platform maximum")
+	}
+	if !errors.Is(err, ErrMapSizeTooLarge) || !strings.Contains(err.Error(), "try a smaller MapSize such as 268435456") {
+		t.Fatalf("err = %v, want ErrMapSizeTooLarge suggesting a smaller MapSize", err)
+	}
+}
+
+func TestMapOpenError(t *testing.T) {
+	enomem := &lmdb.OpError{Op: "mdb_env_open", Errno: syscall.ENOMEM}
+	if err := mapOpenError(enomem, 1<<30); !errors.Is(err, ErrMapSizeTooLarge) || !strings.Contains(err.Error(), "mdb_env_open") {
+		t.Fatalf("ENOMEM on open = %v, want ErrMapSizeTooLarge wrapping the lmdb error", err)
+	}
+	other := &lmdb.OpError{Op: "mdb_env_open", Errno: syscall.EACCES}
+	if err := mapOpenError(other, 1<<30); err != other {
+		t.Fatalf("other errors = %v, want them unchanged", err)
+	}
+}
@@ -0,0 +1,75 @@
+package lmdbstore
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bmatsuo/lmdb-go/lmdb"
+)
+
+// Migration is a single schema or data migration run by Migrator
+//
+// Apply runs inside a write transaction and may write to any database through txn,
+// all of which is discarded if Apply returns an error.
+// Applying a migration disables the bloom filters of DbConfig.BloomFilter databases
+// until rebuilt with RebuildBloomFilter, and its writes are not recorded by LmdbEnvConfig.Changelog
+//
+type Migration struct {
+	ID    string
+	Apply func(txn *lmdb.Txn) error
+}
+
+// Migrator applies migrations once, recording the IDs of applied migrations in a dedicated database
+type Migrator struct {
+	db *Db
+}
+
+// NewMigrator returns a Migrator recording applied migrations inside db
+//
+// db should be dedicated to the Migrator and not written to otherwise
+//
+func (l *LmdbEnv) NewMigrator(db *Db) *Migrator {
+	return &Migrator{db: db}
+}
+
+// Run applies migrations in order, skipping those already applied
+//
+// Each migration runs in its own transaction together with recording its ID,
+// so a migration is either applied and recorded or neither.
+// Run stops at the first failing migration, leaving the later migrations unapplied
+//
+func (m *Migrator) Run(migrations []Migration) error {
+	for _, migration := range migrations {
+		err := m.db.update(func(txn *lmdb.Txn) error {
+			_, err := m.db.get(txn, []byte(migration.ID))
+			if err == nil {
+				return nil
+			}
+			if err != ErrNotFound {
+				return err
+			}
+			m.db.env.invalidateBloomFilters()
+			err = migration.Apply(txn)
+			if err != nil {
+				return err
+			}
+			return m.db.put(txn, []byte(migration.ID), TimeKey(time.Now()), 0)
+		})
+		if err != nil {
+			return fmt.Errorf("migration %s: %w", migration.ID, err)
+		}
+	}
+	return nil
+}
+
+// Applied reports whether the migration with id was applied, and when
+func (m *Migrator) Applied(id string) (applied bool, at time.Time, err error) {
+	b, err := m.db.Get([]byte(id))
+	if err == ErrNotFound {
+		return false, time.Time{}, nil
+	}
+	if err != nil {
+		return false, time.Time{}, err
+	}
+	return true, KeyTime(b), nil
+}
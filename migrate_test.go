@@ -0,0 +1,76 @@
+package lmdbstore
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bmatsuo/lmdb-go/lmdb"
+)
+
+func TestMigrator(t *testing.T) {
+	env := newTestEnv(t, DbConfig{DbName: "data"}, DbConfig{DbName: "migrations"})
+	data := env.GetDatabase("data")
+	migrator := env.NewMigrator(env.GetDatabase("migrations"))
+	var applied []string
+	migration := func(id string) Migration {
+		return Migration{ID: id, Apply: func(txn *lmdb.Txn) error {
+			applied = append(applied, id)
+			return txn.Put(data.dbi, []byte(id), []byte("done"), 0)
+		}}
+	}
+	migrations := []Migration{migration("001"), migration("002")}
+
+	if err := migrator.Run(migrations); err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 2 || applied[0] != "001" || applied[1] != "002" {
+		t.Fatalf("first run applied %v, want [001 002]", applied)
+	}
+	if got := mustGet(t, data, "002"); got != "done" {
+		t.Fatalf("002 = %q", got)
+	}
+	ok, at, err := migrator.Applied("001")
+	if err != nil || !ok || at.IsZero() {
+		t.Fatalf("Applied(001) = %v, %v, %v", ok, at, err)
+	}
+
+	applied = nil
+	if err := migrator.Run(migrations); err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 0 {
+		t.Fatalf("re-run applied %v, want none", applied)
+	}
+}
+
+func TestMigratorFailure(t *testing.T) {
+	env := newTestEnv(t, DbConfig{DbName: "data"}, DbConfig{DbName: "migrations"})
+	data := env.GetDatabase("data")
+	migrator := env.NewMigrator(env.GetDatabase("migrations"))
+	errFailed := errors.New("failed")
+	ran := false
+	err := migrator.Run([]Migration{
+		{ID: "001", Apply: func(txn *lmdb.Txn) error {
+			if err := txn.Put(data.dbi, []byte("partial"), []byte("v"), 0); err != nil {
+				return err
+			}
+			return errFailed
+		}},
+		{ID: "002", Apply: func(txn *lmdb.Txn) error {
+			ran = true
+			return nil
+		}},
+	})
+	if !errors.Is(err, errFailed) {
+		t.Fatalf("Run: %v, want the migration's error", err)
+	}
+	if ran {
+		t.Fatal("migration after the failing one ran")
+	}
+	if ok, _, err := migrator.Applied("001"); err != nil || ok {
+		t.Fatalf("failed migration recorded: %v, %v", ok, err)
+	}
+	if _, err := data.Get([]byte("partial")); err != ErrNotFound {
+		t.Fatalf("failed migration's write kept: %v", err)
+	}
+}
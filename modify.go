@@ -0,0 +1,336 @@
+package lmdbstore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/bmatsuo/lmdb-go/lmdb"
+)
+
+// GetSet puts a value with key inside the database and returns the value it replaced
+//
+// If the key did not exist, old is nil and existed is false
+//
+// The read and the write happen in a single transaction,
+// the returned old value is copied for safe use outside the transaction
+//
+// The call will block until the transaction is finished
+//
+func (s *Db) GetSet(key []byte, value interface{}) (old []byte, existed bool, err error) {
+	err = s.update(func(txn *lmdb.Txn) error {
+		old, existed = nil, false
+		bOri, err := s.get(txn, key)
+		if err != nil && err != ErrNotFound {
+			return err
+		}
+		if err == nil {
+			old = make([]byte, len(bOri))
+			copy(old, bOri)
+			existed = true
+		}
+		return s.putValue(txn, key, value)
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return old, existed, nil
+}
+
+// Replace puts a value with key inside the database only if the key already exists
+//
+// If the key does not exist, ErrNotFound is returned and nothing is written.
+// The check and the write happen in a single transaction
+//
+// The call will block until the transaction is finished
+//
+func (s *Db) Replace(key []byte, value interface{}) error {
+	return s.update(func(txn *lmdb.Txn) error {
+		_, err := s.get(txn, key)
+		if err != nil {
+			return err
+		}
+		return s.putValue(txn, key, value)
+	})
+}
+
+// Pop returns the value at key and deletes the key in a single transaction
+//
+// If the key does not exist, ErrNotFound is returned,
+// so of concurrent pops of the same key only one returns the value
+//
+// The returned value is copied for safe use outside the transaction
+//
+// The call will block until the transaction is finished
+//
+func (s *Db) Pop(key []byte) (value []byte, err error) {
+	err = s.update(func(txn *lmdb.Txn) error {
+		bOri, err := s.get(txn, key)
+		if err != nil {
+			return err
+		}
+		value = make([]byte, len(bOri))
+		copy(value, bOri)
+		return s.del(txn, key)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// DeleteIf deletes key only if its current value equals expected, in a single transaction
+//
+// Returns whether the key was deleted, an absent key returns false without an error
+//
+// The call will block until the transaction is finished
+//
+func (s *Db) DeleteIf(key, expected []byte) (deleted bool, err error) {
+	err = s.update(func(txn *lmdb.Txn) error {
+		deleted = false
+		bOri, err := s.get(txn, key)
+		if err == ErrNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(bOri, expected) {
+			return nil
+		}
+		err = s.del(txn, key)
+		deleted = err == nil
+		return err
+	})
+	return deleted, err
+}
+
+// PutIfUnchanged puts value at key only if the current value equals expectedCurrent,
+// in a single transaction
+//
+// A nil expectedCurrent requires the key to not exist,
+// while an empty non-nil expectedCurrent requires an empty value.
+// Returns whether value was written
+//
+// The call will block until the transaction is finished
+//
+func (s *Db) PutIfUnchanged(key, value, expectedCurrent []byte) (written bool, err error) {
+	err = s.update(func(txn *lmdb.Txn) error {
+		written = false
+		bOri, err := s.get(txn, key)
+		if err != nil && err != ErrNotFound {
+			return err
+		}
+		exists := err == nil
+		if exists != (expectedCurrent != nil) || !bytes.Equal(bOri, expectedCurrent) {
+			return nil
+		}
+		err = s.put(txn, key, value, 0)
+		written = err == nil
+		return err
+	})
+	return written, err
+}
+
+// Entry is a key and value to be written, the value is encoded the same way as Db.Put
+type Entry struct {
+	Key   []byte
+	Value interface{}
+}
+
+// ErrDuplicateKey is returned by batch writes containing a key more than once
+// on databases with DbConfig.OnDuplicateKey set to DuplicateError
+var ErrDuplicateKey = errors.New("duplicate key in batch")
+
+// DuplicateKeyPolicy selects how batch writes handle a key appearing more than once in the batch
+type DuplicateKeyPolicy int
+
+const (
+	// DuplicateLastWins writes the entries in order, so the last entry of a repeated key wins
+	DuplicateLastWins DuplicateKeyPolicy = iota
+	// DuplicateError fails the batch with ErrDuplicateKey before any of its entries are written
+	DuplicateError
+)
+
+// checkDuplicates returns ErrDuplicateKey if the n keys returned by key repeat
+// and the database uses DuplicateError
+func (s *Db) checkDuplicates(n int, key func(i int) []byte) error {
+	if s.onDuplicateKey != DuplicateError {
+		return nil
+	}
+	seen := make(map[string]struct{}, n)
+	for i := 0; i < n; i++ {
+		err := s.checkDuplicate(seen, key(i))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkDuplicate adds key to seen, returning ErrDuplicateKey if it was already there
+// and the database uses DuplicateError
+func (s *Db) checkDuplicate(seen map[string]struct{}, key []byte) error {
+	if s.onDuplicateKey != DuplicateError {
+		return nil
+	}
+	if _, ok := seen[string(key)]; ok {
+		return fmt.Errorf("%w: %q", ErrDuplicateKey, key)
+	}
+	seen[string(key)] = struct{}{}
+	return nil
+}
+
+// UpsertMany writes entries in a single transaction, resolving existing keys with onConflict
+//
+// Entries whose key does not exist are inserted. For existing keys, onConflict receives
+// the stored and the incoming encoded values and returns the value to store,
+// or nil to delete the key. A nil onConflict stores the incoming value.
+// The slices passed to onConflict are only valid until it returns
+//
+// Entries are applied in order, so with DuplicateLastWins a repeated key
+// is resolved against the value of its earlier entry.
+// If onConflict or any write returns an error, none of the entries are written
+//
+// The call will block until the transaction is finished
+//
+func (s *Db) UpsertMany(entries []Entry, onConflict func(key, existing, incoming []byte) ([]byte, error)) error {
+	err := s.checkDuplicates(len(entries), func(i int) []byte { return entries[i].Key })
+	if err != nil {
+		return err
+	}
+	return s.update(func(txn *lmdb.Txn) error {
+		for _, entry := range entries {
+			incoming, err := s.encode(entry.Key, entry.Value)
+			if err != nil {
+				return err
+			}
+			existing, err := s.get(txn, entry.Key)
+			if err != nil && err != ErrNotFound {
+				return err
+			}
+			if err == nil && onConflict != nil {
+				merged, err := onConflict(entry.Key, existing, incoming)
+				if err != nil {
+					return err
+				}
+				if merged == nil {
+					err = s.del(txn, entry.Key)
+					if err != nil {
+						return err
+					}
+					continue
+				}
+				incoming = merged
+			}
+			err = s.put(txn, entry.Key, incoming, 0)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SyncWith makes the keys starting with prefix match desired in a single transaction
+//
+// Keys of desired that do not exist are added, keys whose value differs are updated,
+// and existing keys starting with prefix that are not in desired are removed.
+// Keys whose value already matches are not written.
+// Keys of desired are written even if they do not start with prefix
+//
+// The call will block until the transaction is finished
+//
+func (s *Db) SyncWith(prefix []byte, desired map[string][]byte) (added, updated, removed int, err error) {
+	keys := make([]string, 0, len(desired))
+	for key := range desired {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	err = s.update(func(txn *lmdb.Txn) error {
+		added, updated, removed = 0, 0, 0
+		var stale [][]byte
+		err := s.walkRange(txn, prefix, prefixEnd(prefix), func(key, value []byte) error {
+			if _, ok := desired[string(key)]; !ok {
+				stale = append(stale, copyBytes(key))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, key := range stale {
+			err = s.del(txn, key)
+			if err != nil {
+				return err
+			}
+			removed++
+		}
+		for _, key := range keys {
+			bOri, err := s.get(txn, []byte(key))
+			if err != nil && err != ErrNotFound {
+				return err
+			}
+			exists := err == nil
+			if exists && bytes.Equal(bOri, desired[key]) {
+				continue
+			}
+			err = s.put(txn, []byte(key), desired[key], 0)
+			if err != nil {
+				return err
+			}
+			if exists {
+				updated++
+			} else {
+				added++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	return added, updated, removed, nil
+}
+
+// IncrementMany adds each delta to the counter at its key in a single transaction
+// and returns the resulting values
+//
+// Counters are stored as 8 byte big-endian int64 values, absent keys start at 0.
+// If any existing value is not 8 bytes long, none of the counters are changed
+//
+// The call will block until the transaction is finished
+//
+func (s *Db) IncrementMany(deltas map[string]int64) (values map[string]int64, err error) {
+	err = s.update(func(txn *lmdb.Txn) error {
+		values = make(map[string]int64, len(deltas))
+		for key, delta := range deltas {
+			var n int64
+			bOri, err := s.get(txn, []byte(key))
+			if err != nil && err != ErrNotFound {
+				return err
+			}
+			if err == nil {
+				if len(bOri) != 8 {
+					return fmt.Errorf("counter %q is %d bytes, not 8", key, len(bOri))
+				}
+				n = int64(binary.BigEndian.Uint64(bOri))
+			}
+			n += delta
+			b := make([]byte, 8)
+			binary.BigEndian.PutUint64(b, uint64(n))
+			err = s.put(txn, []byte(key), b, 0)
+			if err != nil {
+				return err
+			}
+			values[key] = n
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
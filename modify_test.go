@@ -0,0 +1,346 @@
+package lmdbstore
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetSet(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	old, existed, err := db.GetSet([]byte("k"), []byte("first"))
+	if err != nil || existed || old != nil {
+		t.Fatalf("new key: %q, %v, %v", old, existed, err)
+	}
+	old, existed, err = db.GetSet([]byte("k"), []byte("second"))
+	if err != nil || !existed || string(old) != "first" {
+		t.Fatalf("existing key: %q, %v, %v", old, existed, err)
+	}
+	if got := mustGet(t, db, "k"); got != "second" {
+		t.Fatalf("value = %q, want second", got)
+	}
+}
+
+func TestUpsertMany(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	mustPut(t, db, "merge", []byte("old"))
+	mustPut(t, db, "remove", []byte("old"))
+	var conflicts []string
+	err := db.UpsertMany([]Entry{
+		{Key: []byte("new"), Value: []byte("incoming")},
+		{Key: []byte("merge"), Value: []byte("incoming")},
+		{Key: []byte("remove"), Value: []byte("incoming")},
+	}, func(key, existing, incoming []byte) ([]byte, error) {
+		conflicts = append(conflicts, string(key))
+		if string(key) == "remove" {
+			return nil, nil
+		}
+		return append(append([]byte{}, existing...), incoming...), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(conflicts); got != "[merge remove]" {
+		t.Fatalf("conflicts = %s", got)
+	}
+	if got := mustGet(t, db, "new"); got != "incoming" {
+		t.Fatalf("new = %q", got)
+	}
+	if got := mustGet(t, db, "merge"); got != "oldincoming" {
+		t.Fatalf("merge = %q", got)
+	}
+	if _, err := db.Get([]byte("remove")); err != ErrNotFound {
+		t.Fatalf("remove: %v, want ErrNotFound", err)
+	}
+}
+
+func TestUpsertManyRollback(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	mustPut(t, db, "k", []byte("old"))
+	errConflict := errors.New("conflict")
+	err := db.UpsertMany([]Entry{
+		{Key: []byte("new"), Value: []byte("v")},
+		{Key: []byte("k"), Value: []byte("v")},
+	}, func(key, existing, incoming []byte) ([]byte, error) {
+		return nil, errConflict
+	})
+	if err != errConflict {
+		t.Fatalf("err = %v, want the error of onConflict", err)
+	}
+	if got := fmt.Sprint(keysOf(t, db)); got != "[k]" {
+		t.Fatalf("keys = %s after a failed upsert", got)
+	}
+}
+
+func TestPop(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	mustPut(t, db, "k", []byte("v"))
+	b, err := db.Pop([]byte("k"))
+	if err != nil || string(b) != "v" {
+		t.Fatalf("Pop = %q, %v", b, err)
+	}
+	if _, err := db.Pop([]byte("k")); err != ErrNotFound {
+		t.Fatalf("second Pop: %v, want ErrNotFound", err)
+	}
+	if _, err := db.Get([]byte("k")); err != ErrNotFound {
+		t.Fatalf("Get after Pop: %v, want ErrNotFound", err)
+	}
+}
+
+func TestPopConcurrent(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	mustPut(t, db, "job", []byte("v"))
+	const poppers = 8
+	results := make(chan error, poppers)
+	for i := 0; i < poppers; i++ {
+		go func() {
+			_, err := db.Pop([]byte("job"))
+			results <- err
+		}()
+	}
+	popped := 0
+	for i := 0; i < poppers; i++ {
+		switch err := <-results; err {
+		case nil:
+			popped++
+		case ErrNotFound:
+		default:
+			t.Fatal(err)
+		}
+	}
+	if popped != 1 {
+		t.Fatalf("%d pops succeeded, want 1", popped)
+	}
+}
+
+func TestDeleteIf(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	mustPut(t, db, "k", []byte("v"))
+	deleted, err := db.DeleteIf([]byte("k"), []byte("other"))
+	if err != nil || deleted {
+		t.Fatalf("mismatched DeleteIf = %v, %v", deleted, err)
+	}
+	if got := mustGet(t, db, "k"); got != "v" {
+		t.Fatalf("value after mismatch = %q, want v", got)
+	}
+	deleted, err = db.DeleteIf([]byte("k"), []byte("v"))
+	if err != nil || !deleted {
+		t.Fatalf("matching DeleteIf = %v, %v", deleted, err)
+	}
+	if _, err := db.Get([]byte("k")); err != ErrNotFound {
+		t.Fatalf("Get after DeleteIf: %v, want ErrNotFound", err)
+	}
+	deleted, err = db.DeleteIf([]byte("k"), []byte("v"))
+	if err != nil || deleted {
+		t.Fatalf("absent DeleteIf = %v, %v", deleted, err)
+	}
+}
+
+func TestPutIfUnchanged(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	for _, c := range []struct {
+		name            string
+		value, expected []byte
+		want            bool
+		stored          string
+	}{
+		{"create absent", []byte("v1"), nil, true, "v1"},
+		{"nil expected but present", []byte("other"), nil, false, "v1"},
+		{"mismatch", []byte("other"), []byte("v0"), false, "v1"},
+		{"match", []byte("v2"), []byte("v1"), true, "v2"},
+		{"match to empty", []byte{}, []byte("v2"), true, ""},
+		{"empty expected matches empty", []byte("v3"), []byte{}, true, "v3"},
+	} {
+		written, err := db.PutIfUnchanged([]byte("k"), c.value, c.expected)
+		if err != nil || written != c.want {
+			t.Fatalf("%s: written = %v, %v, want %v", c.name, written, err, c.want)
+		}
+		if got := mustGet(t, db, "k"); got != c.stored {
+			t.Fatalf("%s: stored %q, want %q", c.name, got, c.stored)
+		}
+	}
+	// an empty expected value does not match an absent key
+	written, err := db.PutIfUnchanged([]byte("absent"), []byte("v"), []byte{})
+	if err != nil || written {
+		t.Fatalf("empty expected on absent key: %v, %v", written, err)
+	}
+	if _, err := db.Get([]byte("absent")); err != ErrNotFound {
+		t.Fatalf("absent key written: %v", err)
+	}
+}
+
+func TestIncrementMany(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	values, err := db.IncrementMany(map[string]int64{"up": 5, "down": -3})
+	if err != nil || values["up"] != 5 || values["down"] != -3 {
+		t.Fatalf("creating counters = %v, %v", values, err)
+	}
+	values, err = db.IncrementMany(map[string]int64{"up": -7, "down": 10, "new": 1})
+	if err != nil || values["up"] != -2 || values["down"] != 7 || values["new"] != 1 {
+		t.Fatalf("mixed deltas = %v, %v", values, err)
+	}
+	if got := mustGet(t, db, "down"); got != "\x00\x00\x00\x00\x00\x00\x00\x07" {
+		t.Fatalf("down stored as %q, want 8 byte big-endian 7", got)
+	}
+
+	// a malformed counter leaves every counter unchanged
+	mustPut(t, db, "bad", []byte("short"))
+	if _, err := db.IncrementMany(map[string]int64{"up": 1, "bad": 1}); err == nil {
+		t.Fatal("malformed counter returned no error")
+	}
+	values, err = db.IncrementMany(map[string]int64{"up": 0})
+	if err != nil || values["up"] != -2 {
+		t.Fatalf("up after the failed batch = %v, %v, want -2", values, err)
+	}
+}
+
+func TestReplace(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	mustPut(t, db, "k", []byte("old"))
+	if err := db.Replace([]byte("k"), []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	if got := mustGet(t, db, "k"); got != "new" {
+		t.Fatalf("replaced value = %q, want new", got)
+	}
+	if err := db.Replace([]byte("absent"), []byte("v")); err != ErrNotFound {
+		t.Fatalf("absent key: %v, want ErrNotFound", err)
+	}
+	if _, err := db.Get([]byte("absent")); err != ErrNotFound {
+		t.Fatalf("Replace wrote an absent key: %v", err)
+	}
+}
+
+// streamRecords returns the StreamTo records of alternating keys and values
+func streamRecords(kvs ...string) ([]byte, error) {
+	var buf bytes.Buffer
+	bw := bufio.NewWriter(&buf)
+	for i := 0; i+1 < len(kvs); i += 2 {
+		if err := writeStreamRecord(bw, []byte(kvs[i]), []byte(kvs[i+1])); err != nil {
+			return nil, err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// duplicateWrites are the batch writes of the repeated key "k", set to first then second,
+// along with the key "other"
+var duplicateWrites = map[string]func(db *Db) error{
+	"UpsertMany": func(db *Db) error {
+		return db.UpsertMany([]Entry{
+			{Key: []byte("k"), Value: []byte("first")},
+			{Key: []byte("other"), Value: []byte("v")},
+			{Key: []byte("k"), Value: []byte("second")},
+		}, func(key, existing, incoming []byte) ([]byte, error) { return incoming, nil })
+	},
+	"PutTTLBatch": func(db *Db) error {
+		return db.PutTTLBatch([]TTLEntry{
+			{Key: []byte("k"), Value: []byte("first"), TTL: time.Hour},
+			{Key: []byte("other"), Value: []byte("v"), TTL: time.Hour},
+			{Key: []byte("k"), Value: []byte("second"), TTL: time.Hour},
+		})
+	},
+	"Pipe.Exec": func(db *Db) error {
+		return db.Pipeline().
+			Set([]byte("k"), []byte("first")).
+			Set([]byte("other"), []byte("v")).
+			Delete([]byte("k")).
+			Set([]byte("k"), []byte("second")).
+			Exec()
+	},
+	"ImportJSON": func(db *Db) error {
+		return db.ImportJSON(strings.NewReader(`[
+			{"key": "aw==", "value": "Zmlyc3Q="},
+			{"key": "b3RoZXI=", "value": "dg=="},
+			{"key": "aw==", "value": "c2Vjb25k"}
+		]`))
+	},
+	"StreamFrom": func(db *Db) error {
+		stream, err := streamRecords("k", "first", "other", "v", "k", "second")
+		if err != nil {
+			return err
+		}
+		return db.StreamFrom(bytes.NewReader(stream))
+	},
+}
+
+func TestDuplicateLastWins(t *testing.T) {
+	for name, write := range duplicateWrites {
+		db := newTestEnv(t, DbConfig{DbName: "a", TTL: true}).GetDatabase("a")
+		if err := write(db); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got := mustGet(t, db, "k"); got != "second" {
+			t.Fatalf("%s: k = %q, want the last value", name, got)
+		}
+		if got := mustGet(t, db, "other"); got != "v" {
+			t.Fatalf("%s: other = %q", name, got)
+		}
+	}
+}
+
+func TestDuplicateError(t *testing.T) {
+	for name, write := range duplicateWrites {
+		db := newTestEnv(t, DbConfig{DbName: "a", TTL: true, OnDuplicateKey: DuplicateError}).GetDatabase("a")
+		if err := write(db); !errors.Is(err, ErrDuplicateKey) {
+			t.Fatalf("%s: %v, want ErrDuplicateKey", name, err)
+		}
+		if keys := keysOf(t, db); len(keys) != 0 {
+			t.Fatalf("%s: wrote %v before failing", name, keys)
+		}
+	}
+}
+
+func TestDuplicateErrorAcrossBatches(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a", OnDuplicateKey: DuplicateError}).GetDatabase("a")
+	stream, err := streamRecords("a", "v", "b", "v", "c", "v", "a", "v")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.LoadFrom(bytes.NewReader(stream), 2, nil); !errors.Is(err, ErrDuplicateKey) {
+		t.Fatalf("LoadFrom: %v, want ErrDuplicateKey", err)
+	}
+	// the repeat is in the second batch, the first stays written
+	if got := fmt.Sprint(keysOf(t, db)); got != "[a b]" {
+		t.Fatalf("keys = %s, want [a b]", got)
+	}
+}
+
+func TestSyncWith(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	mustPut(t, db, "user/same", []byte("v"))
+	mustPut(t, db, "user/changed", []byte("old"))
+	mustPut(t, db, "user/stale", []byte("v"))
+	mustPut(t, db, "other/kept", []byte("v"))
+
+	added, updated, removed, err := db.SyncWith([]byte("user/"), map[string][]byte{
+		"user/same":    []byte("v"),
+		"user/changed": []byte("new"),
+		"user/new":     []byte("v"),
+	})
+	if err != nil || added != 1 || updated != 1 || removed != 1 {
+		t.Fatalf("SyncWith = %d added, %d updated, %d removed, %v, want 1 each", added, updated, removed, err)
+	}
+	if got := fmt.Sprint(keysOf(t, db)); got != "[other/kept user/changed user/new user/same]" {
+		t.Fatalf("keys = %s", got)
+	}
+	if got := mustGet(t, db, "user/changed"); got != "new" {
+		t.Fatalf("user/changed = %q, want new", got)
+	}
+
+	// an empty desired set removes everything under the prefix only
+	added, updated, removed, err = db.SyncWith([]byte("user/"), nil)
+	if err != nil || added != 0 || updated != 0 || removed != 3 {
+		t.Fatalf("empty desired = %d added, %d updated, %d removed, %v", added, updated, removed, err)
+	}
+	if got := fmt.Sprint(keysOf(t, db)); got != "[other/kept]" {
+		t.Fatalf("keys after emptying the prefix = %s", got)
+	}
+}
@@ -0,0 +1,100 @@
+package lmdbstore
+
+import (
+	"github.com/bmatsuo/lmdb-go/lmdb"
+)
+
+// Pipe accumulates writes to a single database to be applied in one transaction
+//
+// Pipe should be created with Db.Pipeline and is not safe for concurrent use
+//
+type Pipe struct {
+	db  *Db
+	ops []pipeOp
+}
+
+type pipeOp struct {
+	key   []byte
+	value interface{}
+	del   bool
+}
+
+// Pipeline returns an empty Pipe for the database
+//
+// Writes are chained with Set and Delete, then applied atomically with Exec
+//
+//	err := db.Pipeline().Set(k1, v1).Set(k2, v2).Delete(k3).Exec()
+//
+func (s *Db) Pipeline() *Pipe {
+	return &Pipe{db: s}
+}
+
+// Set adds a put of value at key to the pipeline
+//
+// value is encoded the same way as Db.Put when the pipeline is executed
+//
+func (p *Pipe) Set(key []byte, value interface{}) *Pipe {
+	p.ops = append(p.ops, pipeOp{key: key, value: value})
+	return p
+}
+
+// PipeSet is Pipe.Set taking a value of type T, for pipelines chaining values of one type
+//
+// Go methods cannot have type parameters, so the typed variant is a function
+//
+//	err := lmdbstore.PipeSet(lmdbstore.PipeSet(db.Pipeline(), k1, v1), k2, v2).Exec()
+//
+func PipeSet[T any](p *Pipe, key []byte, value T) *Pipe {
+	return p.Set(key, value)
+}
+
+// Delete adds a deletion of key to the pipeline
+//
+// Deleting a key that does not exist is not an error
+//
+func (p *Pipe) Delete(key []byte) *Pipe {
+	p.ops = append(p.ops, pipeOp{key: key, del: true})
+	return p
+}
+
+// Len returns the number of writes in the pipeline
+func (p *Pipe) Len() int {
+	return len(p.ops)
+}
+
+// Exec applies every write of the pipeline in order inside a single transaction
+//
+// If any write fails, none of the writes are applied.
+// A key set more than once is handled by DbConfig.OnDuplicateKey
+//
+// The call will block until the transaction is finished
+//
+func (p *Pipe) Exec() error {
+	seen := make(map[string]struct{}, len(p.ops))
+	for _, op := range p.ops {
+		if op.del {
+			continue
+		}
+		err := p.db.checkDuplicate(seen, op.key)
+		if err != nil {
+			return err
+		}
+	}
+	return p.db.update(func(txn *lmdb.Txn) error {
+		for _, op := range p.ops {
+			var err error
+			if op.del {
+				err = p.db.del(txn, op.key)
+				if lmdb.IsNotFound(err) {
+					err = nil
+				}
+			} else {
+				err = p.db.putValue(txn, op.key, op.value)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,44 @@
+package lmdbstore
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPipeline(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	mustPut(t, db, "old", []byte("v"))
+	mustPut(t, db, "kept", []byte("v"))
+
+	p := db.Pipeline().
+		Set([]byte("raw"), []byte("bytes")).
+		Delete([]byte("old")).
+		Delete([]byte("never-existed")).
+		Set([]byte("tmp"), []byte("v")).
+		Delete([]byte("tmp"))
+	p = PipeSet(PipeSet(p, []byte("rec/1"), testRecord{ID: 1, Name: "one"}), []byte("rec/2"), testRecord{ID: 2, Name: "two"})
+	if p.Len() != 7 {
+		t.Fatalf("Len = %d, want 7", p.Len())
+	}
+	if err := p.Exec(); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(keysOf(t, db)); got != "[kept raw rec/1 rec/2]" {
+		t.Fatalf("keys = %s", got)
+	}
+	var rec testRecord
+	if err := db.GetAndMarshal([]byte("rec/2"), &rec); err != nil || rec.Name != "two" {
+		t.Fatalf("rec/2 = %+v, %v", rec, err)
+	}
+}
+
+func TestPipelineAtomic(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	err := db.Pipeline().Set([]byte("a"), []byte("v")).Set([]byte("b"), make(chan int)).Exec()
+	if err == nil {
+		t.Fatal("unmarshalable value was accepted")
+	}
+	if keys := keysOf(t, db); len(keys) != 0 {
+		t.Fatalf("keys = %v after a failed pipeline", keys)
+	}
+}
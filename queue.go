@@ -0,0 +1,76 @@
+package lmdbstore
+
+import (
+	"fmt"
+
+	"github.com/bmatsuo/lmdb-go/lmdb"
+)
+
+// Queue is a FIFO queue of payloads stored in a database with DbConfig.Sequence
+//
+// Payloads are enqueued with Append and dequeued from the lowest sequence number,
+// both in single transactions, so a Queue is safe to use across goroutines
+//
+type Queue struct {
+	db *Db
+}
+
+// NewQueue returns a Queue on the database named name, which must be configured with DbConfig.Sequence
+func (l *LmdbEnv) NewQueue(name string) (*Queue, error) {
+	db := l.GetDatabase(name)
+	if db == nil {
+		return nil, fmt.Errorf("database %s does not exist", name)
+	}
+	if !db.sequence {
+		return nil, fmt.Errorf("database %s: %w", name, ErrSequenceNotEnabled)
+	}
+	return &Queue{db: db}, nil
+}
+
+// Enqueue adds payload at the end of the queue
+//
+// The call will block until the transaction is finished
+//
+func (q *Queue) Enqueue(payload []byte) error {
+	_, err := q.db.Append(payload)
+	return err
+}
+
+// Dequeue removes and returns the payload at the front of the queue
+//
+// ok is false when the queue is empty
+//
+// The call will block until the transaction is finished
+//
+func (q *Queue) Dequeue() (payload []byte, ok bool, err error) {
+	err = q.db.update(func(txn *lmdb.Txn) error {
+		var key []byte
+		payload, ok = nil, false
+		err := q.db.walkRange(txn, nil, nil, func(k, v []byte) error {
+			kv := newKV(k, v)
+			key, payload, ok = kv.Key, kv.Value, true
+			return ErrStopIteration
+		})
+		if err != nil || !ok {
+			return err
+		}
+		return q.db.del(txn, key)
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return payload, ok, nil
+}
+
+// Len returns the number of payloads in the queue
+func (q *Queue) Len() (n uint64, err error) {
+	err = q.db.lmdbEnv.View(func(txn *lmdb.Txn) error {
+		stat, err := txn.Stat(q.db.dbi)
+		if err != nil {
+			return err
+		}
+		n = stat.Entries
+		return nil
+	})
+	return n, err
+}
@@ -0,0 +1,97 @@
+package lmdbstore
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestQueueFIFO(t *testing.T) {
+	env := newTestEnv(t, DbConfig{DbName: "jobs", Sequence: true}, DbConfig{DbName: "plain"})
+	q, err := env.NewQueue("jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := q.Dequeue(); err != nil || ok {
+		t.Fatalf("empty queue: ok %v, %v", ok, err)
+	}
+	for _, payload := range []string{"a", "b", "c"} {
+		if err := q.Enqueue([]byte(payload)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n, err := q.Len(); err != nil || n != 3 {
+		t.Fatalf("Len = %d, %v", n, err)
+	}
+	for _, want := range []string{"a", "b", "c"} {
+		payload, ok, err := q.Dequeue()
+		if err != nil || !ok || string(payload) != want {
+			t.Fatalf("Dequeue = %q, %v, %v, want %s", payload, ok, err, want)
+		}
+	}
+	if n, err := q.Len(); err != nil || n != 0 {
+		t.Fatalf("Len = %d, %v after draining", n, err)
+	}
+	if _, err := env.NewQueue("plain"); !errors.Is(err, ErrSequenceNotEnabled) {
+		t.Fatalf("queue without Sequence: %v", err)
+	}
+	if _, err := env.NewQueue("missing"); err == nil {
+		t.Fatal("queue on a missing database")
+	}
+}
+
+func TestQueueConcurrent(t *testing.T) {
+	env := newTestEnv(t, DbConfig{DbName: "jobs", Sequence: true})
+	q, err := env.NewQueue("jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const producers, perProducer = 4, 50
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < perProducer; i++ {
+				if err := q.Enqueue([]byte(fmt.Sprintf("%d/%d", p, i))); err != nil {
+					t.Error(err)
+				}
+			}
+		}(p)
+	}
+	var mu sync.Mutex
+	seen := map[string]bool{}
+	for c := 0; c < 4; c++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				mu.Lock()
+				done := len(seen) == producers*perProducer
+				mu.Unlock()
+				if done {
+					return
+				}
+				payload, ok, err := q.Dequeue()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if !ok {
+					continue
+				}
+				mu.Lock()
+				if seen[string(payload)] {
+					t.Errorf("%s dequeued twice", payload)
+				}
+				seen[string(payload)] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if len(seen) != producers*perProducer {
+		t.Fatalf("dequeued %d payloads, want %d", len(seen), producers*perProducer)
+	}
+}
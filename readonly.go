@@ -0,0 +1,193 @@
+package lmdbstore
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/bmatsuo/lmdb-go/lmdb"
+)
+
+// ReadOnlyDb is a read-only handle to a database, exposing none of the write methods of Db
+//
+// It is backed by the same DBI as the Db it was created from,
+// so writes through the Db are visible to it
+//
+type ReadOnlyDb struct {
+	db *Db
+}
+
+// ReadOnly returns a read-only handle to the database, to hand to components that must not write to it
+func (s *Db) ReadOnly() *ReadOnlyDb {
+	return &ReadOnlyDb{db: s}
+}
+
+// Get is Db.Get
+func (r *ReadOnlyDb) Get(key []byte) ([]byte, error) {
+	return r.db.Get(key)
+}
+
+// Lookup is Db.Lookup
+func (r *ReadOnlyDb) Lookup(key []byte) (value []byte, ok bool, err error) {
+	return r.db.Lookup(key)
+}
+
+// GetOrDefault is Db.GetOrDefault
+func (r *ReadOnlyDb) GetOrDefault(key, def []byte) ([]byte, error) {
+	return r.db.GetOrDefault(key, def)
+}
+
+// Exists is Db.Exists
+func (r *ReadOnlyDb) Exists(key []byte) (bool, error) {
+	return r.db.Exists(key)
+}
+
+// Peek is Db.Peek
+func (r *ReadOnlyDb) Peek(key []byte, fn func(value []byte) error) error {
+	return r.db.Peek(key, fn)
+}
+
+// GetMeta is Db.GetMeta
+func (r *ReadOnlyDb) GetMeta(key []byte) (value []byte, meta EntryMeta, err error) {
+	return r.db.GetMeta(key)
+}
+
+// GetAndMarshal is Db.GetAndMarshal
+func (r *ReadOnlyDb) GetAndMarshal(key []byte, dest interface{}) error {
+	return r.db.GetAndMarshal(key, dest)
+}
+
+// GetTime is Db.GetTime
+func (r *ReadOnlyDb) GetTime(t time.Time, dest interface{}) error {
+	return r.db.GetTime(t, dest)
+}
+
+// RangeTime is Db.RangeTime
+func (r *ReadOnlyDb) RangeTime(from, to time.Time, fn func(t time.Time, value []byte) error) error {
+	return r.db.RangeTime(from, to, fn)
+}
+
+// CountWhere is Db.CountWhere
+func (r *ReadOnlyDb) CountWhere(start, end []byte, pred func(key, value []byte) bool) (uint64, error) {
+	return r.db.CountWhere(start, end, pred)
+}
+
+// Scan is Db.Scan
+func (r *ReadOnlyDb) Scan(prefix []byte, offset, limit int) ([]KV, error) {
+	return r.db.Scan(prefix, offset, limit)
+}
+
+// ForEach is Db.ForEach
+func (r *ReadOnlyDb) ForEach(start, end []byte, fn func(key, value []byte) error) error {
+	return r.db.ForEach(start, end, fn)
+}
+
+// IterateFrom is Db.IterateFrom
+func (r *ReadOnlyDb) IterateFrom(after []byte, fn func(key, value []byte) error) error {
+	return r.db.IterateFrom(after, fn)
+}
+
+// WaitForKey is Db.WaitForKey
+func (r *ReadOnlyDb) WaitForKey(ctx context.Context, key []byte) ([]byte, error) {
+	return r.db.WaitForKey(ctx, key)
+}
+
+// CursorDo is Db.CursorDo, the cursor belongs to a read-only transaction
+func (r *ReadOnlyDb) CursorDo(fn func(cur *lmdb.Cursor) error) error {
+	return r.db.CursorDo(fn)
+}
+
+// ExportJSON is Db.ExportJSON
+func (r *ReadOnlyDb) ExportJSON(w io.Writer) error {
+	return r.db.ExportJSON(w)
+}
+
+// StreamTo is Db.StreamTo
+func (r *ReadOnlyDb) StreamTo(w io.Writer, start, end []byte) error {
+	return r.db.StreamTo(w, start, end)
+}
+
+// GetMultiple is Db.GetMultiple
+func (r *ReadOnlyDb) GetMultiple(key []byte) (values [][]byte, err error) {
+	return r.db.GetMultiple(key)
+}
+
+// GetKey is Db.GetKey
+func (r *ReadOnlyDb) GetKey(key interface{}, dest interface{}) error {
+	return r.db.GetKey(key, dest)
+}
+
+// EncodeKey is Db.EncodeKey
+func (r *ReadOnlyDb) EncodeKey(key interface{}) ([]byte, error) {
+	return r.db.EncodeKey(key)
+}
+
+// DecodeKey is Db.DecodeKey
+func (r *ReadOnlyDb) DecodeKey(b []byte, dest interface{}) error {
+	return r.db.DecodeKey(b, dest)
+}
+
+// FindFirst is Db.FindFirst
+func (r *ReadOnlyDb) FindFirst(pred func(key, value []byte) bool) (key, value []byte, found bool, err error) {
+	return r.db.FindFirst(pred)
+}
+
+// SeparatorAwareScan is Db.SeparatorAwareScan
+func (r *ReadOnlyDb) SeparatorAwareScan(prefix []byte, sep byte, fn func(key, value []byte) error) error {
+	return r.db.SeparatorAwareScan(prefix, sep, fn)
+}
+
+// KeysWithPrefix is Db.KeysWithPrefix
+func (r *ReadOnlyDb) KeysWithPrefix(prefix []byte) (keys [][]byte, err error) {
+	return r.db.KeysWithPrefix(prefix)
+}
+
+// GetWithExpiry is Db.GetWithExpiry
+func (r *ReadOnlyDb) GetWithExpiry(key []byte) (value []byte, remaining time.Duration, err error) {
+	return r.db.GetWithExpiry(key)
+}
+
+// GetAllInto is Db.GetAllInto
+func (r *ReadOnlyDb) GetAllInto(keys [][]byte, dests []interface{}) error {
+	return r.db.GetAllInto(keys, dests)
+}
+
+// ScanSuffix is Db.ScanSuffix
+func (r *ReadOnlyDb) ScanSuffix(suffix []byte, fn func(key, value []byte) error) error {
+	return r.db.ScanSuffix(suffix, fn)
+}
+
+// GetSortedBatch is Db.GetSortedBatch
+func (r *ReadOnlyDb) GetSortedBatch(keys [][]byte) (kvs []KV, err error) {
+	return r.db.GetSortedBatch(keys)
+}
+
+// ExistsPrefix is Db.ExistsPrefix
+func (r *ReadOnlyDb) ExistsPrefix(prefix []byte) (exists bool, err error) {
+	return r.db.ExistsPrefix(prefix)
+}
+
+// DiffAgainst is Db.DiffAgainst
+func (r *ReadOnlyDb) DiffAgainst(other *Db) (added, removed, changed [][]byte, err error) {
+	return r.db.DiffAgainst(other)
+}
+
+// CreatedAt is Db.CreatedAt
+func (r *ReadOnlyDb) CreatedAt(key []byte) (createdAt time.Time, err error) {
+	return r.db.CreatedAt(key)
+}
+
+// ForEachBatch is Db.ForEachBatch
+func (r *ReadOnlyDb) ForEachBatch(batchSize int, fn func(batch []KV) error) error {
+	return r.db.ForEachBatch(batchSize, fn)
+}
+
+// IterateReverseFrom is Db.IterateReverseFrom
+func (r *ReadOnlyDb) IterateReverseFrom(before []byte, fn func(key, value []byte) error) error {
+	return r.db.IterateReverseFrom(before, fn)
+}
+
+// GetRaw is Db.GetRaw
+func (r *ReadOnlyDb) GetRaw(key []byte) (b []byte, err error) {
+	return r.db.GetRaw(key)
+}
@@ -0,0 +1,91 @@
+package lmdbstore
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadOnlyDbHasNoWriteMethods(t *testing.T) {
+	ro, db := reflect.TypeOf(&ReadOnlyDb{}), reflect.TypeOf(&Db{})
+	for i := 0; i < ro.NumMethod(); i++ {
+		m := ro.Method(i)
+		if hasWritePrefix(m.Name) && m.Name != "StreamTo" {
+			t.Errorf("ReadOnlyDb has the write method %s", m.Name)
+		}
+		// every method forwards to the Db method of the same signature
+		dm, ok := db.MethodByName(m.Name)
+		if !ok {
+			t.Errorf("ReadOnlyDb.%s has no Db counterpart", m.Name)
+			continue
+		}
+		if got, want := m.Type.String(), dm.Type.String(); strings.Replace(got, "*lmdbstore.ReadOnlyDb", "*lmdbstore.Db", 1) != want {
+			t.Errorf("ReadOnlyDb.%s is %s, Db.%s is %s", m.Name, got, m.Name, want)
+		}
+	}
+}
+
+// writeMethods are prefixes of Db method names that write
+var writeMethods = []string{"Put", "Set", "Del", "Drop", "Update", "Append", "Import", "Merge", "Modify", "Upsert", "Truncate", "Touch", "Compact", "Stream", "Load", "Purge", "Sync"}
+
+// notForwarded are the Db methods without a ReadOnlyDb counterpart
+// that writeMethods does not already cover
+var notForwarded = map[string]bool{
+	"ReadOnly":           true,
+	"GetSet":             true,
+	"Pipeline":           true,
+	"RebuildBloomFilter": true,
+	"Pop":                true,
+	"IncrementMany":      true,
+	"Replace":            true,
+	"WithKeyLock":        true,
+}
+
+func TestReadOnlyDbHasEveryReadMethod(t *testing.T) {
+	ro, db := reflect.TypeOf(&ReadOnlyDb{}), reflect.TypeOf(&Db{})
+	for i := 0; i < db.NumMethod(); i++ {
+		m := db.Method(i)
+		if notForwarded[m.Name] || (hasWritePrefix(m.Name) && m.Name != "StreamTo") {
+			continue
+		}
+		if _, ok := ro.MethodByName(m.Name); !ok {
+			t.Errorf("Db.%s is not forwarded by ReadOnlyDb, or add it to notForwarded", m.Name)
+		}
+	}
+}
+
+// hasWritePrefix reports whether name starts with one of writeMethods
+func hasWritePrefix(name string) bool {
+	for _, write := range writeMethods {
+		if strings.HasPrefix(name, write) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestReadOnlyDbReads(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	ro := db.ReadOnly()
+	putNumbered(t, db, "key", 5)
+	// writes through the Db are visible to the handle
+	b, err := ro.Get([]byte("key003"))
+	if err != nil || string(b) != "3" {
+		t.Fatalf("Get = %q, %v", b, err)
+	}
+	if ok, err := ro.Exists([]byte("absent")); err != nil || ok {
+		t.Fatalf("Exists = %v, %v", ok, err)
+	}
+	var keys []string
+	err = ro.ForEach([]byte("key001"), []byte("key003"), func(key, value []byte) error {
+		keys = append(keys, string(key))
+		return nil
+	})
+	if err != nil || len(keys) != 2 {
+		t.Fatalf("ForEach = %v, %v", keys, err)
+	}
+	kvs, err := ro.Scan([]byte("key"), 3, 0)
+	if err != nil || len(kvs) != 2 {
+		t.Fatalf("Scan = %v, %v", kvs, err)
+	}
+}
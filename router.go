@@ -0,0 +1,71 @@
+package lmdbstore
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Router spreads keys across databases of a single LmdbEnv by hashing the key
+//
+// Router should always be created by calling LmdbEnv.NewRouter
+//
+type Router struct {
+	dbs  []*Db
+	hash func(key []byte) int
+}
+
+// NewRouter returns a Router over the databases named by names
+//
+// hash maps a key to its database, the result is taken modulo the number of databases,
+// so hash and the order of names should never change for the lifetime of the data
+//
+func (l *LmdbEnv) NewRouter(names []string, hash func(key []byte) int) (*Router, error) {
+	if len(names) < 1 {
+		return nil, errors.New("no databases is setup")
+	}
+	if hash == nil {
+		return nil, errors.New("hash function is required")
+	}
+	router := &Router{hash: hash}
+	for _, name := range names {
+		db := l.GetDatabase(name)
+		if db == nil {
+			return nil, fmt.Errorf("database %s is not configured", name)
+		}
+		router.dbs = append(router.dbs, db)
+	}
+	return router, nil
+}
+
+// DatabaseFor returns the database owning key
+func (r *Router) DatabaseFor(key []byte) *Db {
+	i := r.hash(key) % len(r.dbs)
+	if i < 0 {
+		i += len(r.dbs)
+	}
+	return r.dbs[i]
+}
+
+// Put a value with key inside the owning database
+//
+// The call will block until the transaction is finished
+//
+func (r *Router) Put(key []byte, value interface{}) error {
+	return r.DatabaseFor(key).Put(key, value)
+}
+
+// Get returns the binary value at key inside the owning database
+//
+// If the key does not exist, ErrNotFound is returned
+//
+func (r *Router) Get(key []byte) ([]byte, error) {
+	return r.DatabaseFor(key).Get(key)
+}
+
+// Del a value with key inside the owning database
+//
+// The call will block until the transaction is finished
+//
+func (r *Router) Del(key []byte) error {
+	return r.DatabaseFor(key).Del(key)
+}
@@ -0,0 +1,81 @@
+package lmdbstore
+
+import (
+	"fmt"
+	"hash/fnv"
+	"testing"
+)
+
+func fnvHash(key []byte) int {
+	h := fnv.New32a()
+	h.Write(key)
+	return int(h.Sum32())
+}
+
+func TestRouter(t *testing.T) {
+	env := newTestEnv(t, DbConfig{DbName: "s0"}, DbConfig{DbName: "s1"}, DbConfig{DbName: "s2"}, DbConfig{DbName: "other"})
+	names := []string{"s0", "s1", "s2"}
+	router, err := env.NewRouter(names, fnvHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := env.NewRouter(names, fnvHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	used := map[string]int{}
+	for i := 0; i < 60; i++ {
+		key := []byte(fmt.Sprintf("key%d", i))
+		db := router.DatabaseFor(key)
+		if again.DatabaseFor(key) != db || router.DatabaseFor(key) != db {
+			t.Fatalf("%s routed inconsistently", key)
+		}
+		used[db.name]++
+		if err := router.Put(key, []byte("v")); err != nil {
+			t.Fatal(err)
+		}
+		// the value is only in the owning database
+		if got := mustGet(t, db, string(key)); got != "v" {
+			t.Fatalf("%s in %s = %q", key, db.name, got)
+		}
+		if b, err := router.Get(key); err != nil || string(b) != "v" {
+			t.Fatalf("Get(%s) = %q, %v", key, b, err)
+		}
+	}
+	if len(used) != 3 {
+		t.Fatalf("keys spread over %v, want all 3 databases", used)
+	}
+	if keys := keysOf(t, env.GetDatabase("other")); len(keys) != 0 {
+		t.Fatalf("non-participating database holds %v", keys)
+	}
+	if err := router.Del([]byte("key1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := router.Get([]byte("key1")); err != ErrNotFound {
+		t.Fatalf("Get after Del: %v, want ErrNotFound", err)
+	}
+}
+
+func TestRouterNegativeHash(t *testing.T) {
+	env := newTestEnv(t, DbConfig{DbName: "s0"}, DbConfig{DbName: "s1"})
+	router, err := env.NewRouter([]string{"s0", "s1"}, func(key []byte) int { return -int(key[0]) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db := router.DatabaseFor([]byte{3}); db.name != "s1" {
+		t.Fatalf("hash -3 routed to %s, want s1", db.name)
+	}
+}
+
+func TestNewRouterErrors(t *testing.T) {
+	env := newTestEnv(t, DbConfig{DbName: "s0"})
+	if _, err := env.NewRouter(nil, fnvHash); err == nil {
+		t.Fatal("no databases returned no error")
+	}
+	if _, err := env.NewRouter([]string{"s0"}, nil); err == nil {
+		t.Fatal("nil hash returned no error")
+	}
+	if _, err := env.NewRouter([]string{"s0", "missing"}, fnvHash); err == nil {
+		t.Fatal("unconfigured database returned no error")
+	}
+}
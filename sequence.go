@@ -0,0 +1,76 @@
+package lmdbstore
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/bmatsuo/lmdb-go/lmdb"
+)
+
+// ErrSequenceNotEnabled is returned by Append and TruncateAndReset on databases without DbConfig.Sequence
+var ErrSequenceNotEnabled = errors.New("sequence is not enabled for this database")
+
+// seqCounterKey is the key of the next sequence number inside the sequence sidecar
+var seqCounterKey = []byte("next")
+
+// SequenceKey encodes seq as the 8 byte big-endian key Append writes at
+func SequenceKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
+
+// Append puts value inside the database at the next sequence number and returns it
+//
+// Sequence numbers start at 0 and are never reused, even after the entries are deleted or dropped,
+// until TruncateAndReset is called
+//
+// The call will block until the transaction is finished
+//
+func (s *Db) Append(value interface{}) (seq uint64, err error) {
+	if !s.sequence {
+		return 0, ErrSequenceNotEnabled
+	}
+	err = s.update(func(txn *lmdb.Txn) error {
+		b, err := txn.Get(s.seqDbi, seqCounterKey)
+		if err != nil && !lmdb.IsNotFound(err) {
+			return err
+		}
+		seq = 0
+		if err == nil {
+			seq = binary.BigEndian.Uint64(b)
+		}
+		err = s.putValue(txn, SequenceKey(seq), value)
+		if err != nil {
+			return err
+		}
+		return txn.Put(s.seqDbi, seqCounterKey, SequenceKey(seq+1), 0)
+	})
+	return seq, err
+}
+
+// TruncateAndReset empties the database and resets its sequence counter in a single transaction,
+// so the next Append writes at sequence number 0
+//
+// The call will block until the transaction is finished
+//
+func (s *Db) TruncateAndReset() error {
+	if !s.sequence {
+		return ErrSequenceNotEnabled
+	}
+	return s.update(func(txn *lmdb.Txn) error {
+		err := txn.Drop(s.dbi, false)
+		if err != nil {
+			return err
+		}
+		err = s.dropSidecars(txn)
+		if err != nil {
+			return err
+		}
+		err = s.env.recordChange(txn, s, OpDrop, nil)
+		if err != nil {
+			return err
+		}
+		return txn.Drop(s.seqDbi, false)
+	})
+}
@@ -0,0 +1,46 @@
+package lmdbstore
+
+import (
+	"testing"
+)
+
+func TestTruncateAndReset(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "log", Sequence: true}).GetDatabase("log")
+	for want := uint64(0); want < 3; want++ {
+		seq, err := db.Append([]byte("entry"))
+		if err != nil || seq != want {
+			t.Fatalf("Append = %d, %v, want %d", seq, err, want)
+		}
+	}
+	// Drop keeps the counter
+	if err := db.Drop(); err != nil {
+		t.Fatal(err)
+	}
+	if seq, err := db.Append([]byte("entry")); err != nil || seq != 3 {
+		t.Fatalf("Append after Drop = %d, %v, want 3", seq, err)
+	}
+	if err := db.TruncateAndReset(); err != nil {
+		t.Fatal(err)
+	}
+	if keys := keysOf(t, db); len(keys) != 0 {
+		t.Fatalf("keys = %q after TruncateAndReset", keys)
+	}
+	seq, err := db.Append([]byte("first"))
+	if err != nil || seq != 0 {
+		t.Fatalf("Append after TruncateAndReset = %d, %v, want 0", seq, err)
+	}
+	b, err := db.Get(SequenceKey(0))
+	if err != nil || string(b) != "first" {
+		t.Fatalf("entry 0 = %q, %v", b, err)
+	}
+}
+
+func TestSequenceNotEnabled(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	if _, err := db.Append([]byte("v")); err != ErrSequenceNotEnabled {
+		t.Fatalf("Append: %v, want ErrSequenceNotEnabled", err)
+	}
+	if err := db.TruncateAndReset(); err != ErrSequenceNotEnabled {
+		t.Fatalf("TruncateAndReset: %v, want ErrSequenceNotEnabled", err)
+	}
+}
@@ -0,0 +1,105 @@
+package lmdbstore
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ShardedStore spreads keys across multiple LmdbEnv, each holding a single database
+//
+// ShardedStore should always be created by calling NewShardedStore
+//
+type ShardedStore struct {
+	envs []*LmdbEnv
+	dbs  []*Db
+	hash func(key []byte) int
+}
+
+// NewShardedStore initialize one LmdbEnv per entry of configs as the shards of a ShardedStore
+//
+// Every config must have exactly 1 Databases entry.
+// hash maps a key to its shard, the result is taken modulo the number of shards,
+// so hash and the order of configs should never change for the lifetime of the store
+//
+func NewShardedStore(configs []LmdbEnvConfig, hash func(key []byte) int) (*ShardedStore, error) {
+	if len(configs) < 1 {
+		return nil, errors.New("no shards is setup")
+	}
+	if hash == nil {
+		return nil, errors.New("hash function is required")
+	}
+	store := &ShardedStore{hash: hash}
+	for i, config := range configs {
+		env, err := NewLmdb(config)
+		if err == nil {
+			var db *Db
+			db, err = env.GetSingleDatabase()
+			if err == nil {
+				store.envs = append(store.envs, env)
+				store.dbs = append(store.dbs, db)
+				continue
+			}
+			env.Close()
+		}
+		store.Close()
+		return nil, fmt.Errorf("shard %d: %w", i, err)
+	}
+	return store, nil
+}
+
+// ShardFor returns the index of the shard owning key
+func (s *ShardedStore) ShardFor(key []byte) int {
+	i := s.hash(key) % len(s.dbs)
+	if i < 0 {
+		i += len(s.dbs)
+	}
+	return i
+}
+
+// Shard returns the database of shard i
+func (s *ShardedStore) Shard(i int) *Db {
+	return s.dbs[i]
+}
+
+// Put a value with key inside the owning shard
+//
+// The call will block until the transaction is finished
+//
+func (s *ShardedStore) Put(key []byte, value interface{}) error {
+	i := s.ShardFor(key)
+	return shardErr(i, s.dbs[i].Put(key, value))
+}
+
+// Get returns the binary value at key inside the owning shard
+//
+// If the key does not exist, an error wrapping ErrNotFound is returned
+//
+func (s *ShardedStore) Get(key []byte) ([]byte, error) {
+	i := s.ShardFor(key)
+	b, err := s.dbs[i].Get(key)
+	return b, shardErr(i, err)
+}
+
+// Del a value with key inside the owning shard
+//
+// The call will block until the transaction is finished
+//
+func (s *ShardedStore) Del(key []byte) error {
+	i := s.ShardFor(key)
+	return shardErr(i, s.dbs[i].Del(key))
+}
+
+// Close closes every shard
+func (s *ShardedStore) Close() {
+	for _, env := range s.envs {
+		env.Close()
+	}
+}
+
+// shardErr adds the shard index to err
+func shardErr(i int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("shard %d: %w", i, err)
+}
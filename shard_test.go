@@ -0,0 +1,84 @@
+package lmdbstore
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// testShardConfigs returns n single-database configs in temporary directories
+func testShardConfigs(t *testing.T, n int) []LmdbEnvConfig {
+	configs := make([]LmdbEnvConfig, n)
+	for i := range configs {
+		configs[i] = DefaultLmdbConfig
+		configs[i].OpenPath = t.TempDir()
+	}
+	return configs
+}
+
+// firstByte shards by the first byte of the key
+func firstByte(key []byte) int {
+	return int(key[0])
+}
+
+func TestShardedStoreRouting(t *testing.T) {
+	store, err := NewShardedStore(testShardConfigs(t, 3), firstByte)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	for _, key := range []string{"a1", "b1", "c1", "a2"} {
+		if err := store.Put([]byte(key), []byte(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, key := range []string{"a1", "b1", "c1", "a2"} {
+		shard := store.ShardFor([]byte(key))
+		if shard != int(key[0])%3 {
+			t.Fatalf("%s routed to shard %d", key, shard)
+		}
+		if shard != store.ShardFor([]byte(key)) {
+			t.Fatalf("%s routed inconsistently", key)
+		}
+		b, err := store.Shard(shard).Get([]byte(key))
+		if err != nil || string(b) != key {
+			t.Fatalf("%s in its shard: %q, %v", key, b, err)
+		}
+		for i := 0; i < 3; i++ {
+			if i == shard {
+				continue
+			}
+			if _, err := store.Shard(i).Get([]byte(key)); err != ErrNotFound {
+				t.Fatalf("%s found in shard %d", key, i)
+			}
+		}
+	}
+	if err := store.Del([]byte("a1")); err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.Get([]byte("a1"))
+	if !errors.Is(err, ErrNotFound) || !strings.Contains(err.Error(), "shard 1") {
+		t.Fatalf("deleted key: %v, want ErrNotFound with its shard", err)
+	}
+}
+
+func TestShardedStoreErrors(t *testing.T) {
+	configs := testShardConfigs(t, 2)
+	configs[1].MaxValueSize = 1
+	store, err := NewShardedStore(configs, firstByte)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	// "a" is 97, owned by shard 1
+	err = store.Put([]byte("a"), []byte("too large"))
+	if !errors.Is(err, ErrValueTooLarge) || !strings.Contains(err.Error(), "shard 1") {
+		t.Fatalf("err = %v, want ErrValueTooLarge with its shard", err)
+	}
+
+	configs = testShardConfigs(t, 2)
+	configs[1].Databases = []DbConfig{{DbName: "a"}, {DbName: "b"}}
+	if _, err := NewShardedStore(configs, firstByte); err == nil || !strings.HasPrefix(err.Error(), "shard 1:") {
+		t.Fatalf("err = %v, want an error of shard 1", err)
+	}
+}
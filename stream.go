@@ -0,0 +1,274 @@
+package lmdbstore
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/bmatsuo/lmdb-go/lmdb"
+)
+
+var (
+	// ErrTruncatedStream is returned by StreamFrom when the stream ends inside a record
+	ErrTruncatedStream = errors.New("stream truncated inside a record")
+	// ErrMalformedRecord is returned by StreamFrom when a record is not a key and value message
+	ErrMalformedRecord = errors.New("malformed stream record")
+	// ErrStreamSize is returned by PutStream when the reader does not yield exactly size bytes
+	ErrStreamSize = errors.New("reader length does not match size")
+)
+
+// protobuf tags of the key (field 1) and value (field 2) of a stream record,
+// both with the length-delimited wire type
+const (
+	streamKeyTag   = 1<<3 | 2
+	streamValueTag = 2<<3 | 2
+)
+
+// StreamTo writes every entry with start <= key < end to w as varint length-delimited records,
+// in key order
+//
+// Empty start begins at the first key, nil end continues to the last key.
+// Each record is a protobuf message with the key as bytes field 1 and the value as bytes field 2,
+// so the stream can be read by common delimited protobuf readers.
+// All entries are read from a single View, so the stream is a consistent snapshot
+//
+func (s *Db) StreamTo(w io.Writer, start, end []byte) error {
+	bw := bufio.NewWriter(w)
+	err := s.lmdbEnv.View(func(txn *lmdb.Txn) error {
+		return s.walkRange(txn, start, end, func(key, value []byte) error {
+			return writeStreamRecord(bw, key, value)
+		})
+	})
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// StreamFrom reads records written by StreamTo from r and puts every entry inside the database
+//
+// Entries are written in transactions of up to 1000 entries,
+// so a failure midway leaves the earlier batches written.
+// A stream ending inside a record returns ErrTruncatedStream.
+// A repeated key is handled by DbConfig.OnDuplicateKey
+//
+func (s *Db) StreamFrom(r io.Reader) error {
+	return s.LoadFrom(r, importBatchSize, nil)
+}
+
+// LoadFrom is StreamFrom writing transactions of up to batchSize entries
+// and calling progress with the total number of entries loaded after each transaction
+//
+// batchSize <= 0 defaults to 1000, progress is optional
+//
+func (s *Db) LoadFrom(r io.Reader, batchSize int, progress func(loaded int)) error {
+	if batchSize <= 0 {
+		batchSize = importBatchSize
+	}
+	br := bufio.NewReader(r)
+	batch := make([]KV, 0, batchSize)
+	seen := make(map[string]struct{})
+	loaded := 0
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := s.putKVs(batch)
+		if err != nil {
+			return err
+		}
+		loaded += len(batch)
+		batch = batch[:0]
+		if progress != nil {
+			progress(loaded)
+		}
+		return nil
+	}
+	for {
+		kv, err := readStreamRecord(br)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		err = s.checkDuplicate(seen, kv.Key)
+		if err != nil {
+			return err
+		}
+		batch = append(batch, kv)
+		if len(batch) == batchSize {
+			err = flush()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return flush()
+}
+
+// putKVs puts kvs inside the database in a single transaction
+func (s *Db) putKVs(kvs []KV) error {
+	if len(kvs) == 0 {
+		return nil
+	}
+	return s.update(func(txn *lmdb.Txn) error {
+		for _, kv := range kvs {
+			err := s.put(txn, kv.Key, kv.Value, 0)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// writeStreamRecord writes the length prefix and message of a single record
+func writeStreamRecord(w *bufio.Writer, key, value []byte) error {
+	var buf [binary.MaxVarintLen64]byte
+	size := 1 + binary.PutUvarint(buf[:], uint64(len(key))) + len(key) +
+		1 + binary.PutUvarint(buf[:], uint64(len(value))) + len(value)
+	_, err := w.Write(buf[:binary.PutUvarint(buf[:], uint64(size))])
+	if err != nil {
+		return err
+	}
+	for _, field := range []struct {
+		tag  byte
+		data []byte
+	}{{streamKeyTag, key}, {streamValueTag, value}} {
+		err = w.WriteByte(field.tag)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(buf[:binary.PutUvarint(buf[:], uint64(len(field.data)))])
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(field.data)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// maxStreamRecordSize bounds the size prefix of a record to the largest value lmdb can store
+// plus room for the key and field headers
+const maxStreamRecordSize = 1<<32 + 1<<16
+
+// streamPreallocSize is the largest record size allocated up front,
+// larger records grow as their bytes arrive so a corrupt size cannot force a huge allocation
+const streamPreallocSize = 1 << 16
+
+// readStreamBytes reads the size bytes of a record, returning ErrTruncatedStream if r ends first
+func readStreamBytes(r io.Reader, size uint64) ([]byte, error) {
+	if size <= streamPreallocSize {
+		record := make([]byte, size)
+		_, err := io.ReadFull(r, record)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrTruncatedStream
+		}
+		return record, err
+	}
+	var buf bytes.Buffer
+	n, err := io.CopyN(&buf, r, int64(size))
+	if err == io.EOF || uint64(n) < size {
+		return nil, ErrTruncatedStream
+	}
+	return buf.Bytes(), err
+}
+
+// readStreamSize reads the varint size prefix of a record, returning ErrMalformedRecord if it overflows 64 bits
+func readStreamSize(r *bufio.Reader) (uint64, error) {
+	var prefix [binary.MaxVarintLen64]byte
+	for i := range prefix {
+		c, err := r.ReadByte()
+		if err == io.EOF && i > 0 {
+			return 0, ErrTruncatedStream
+		}
+		if err != nil {
+			return 0, err
+		}
+		prefix[i] = c
+		if c < 0x80 {
+			size, n := binary.Uvarint(prefix[:i+1])
+			if n <= 0 {
+				return 0, ErrMalformedRecord
+			}
+			return size, nil
+		}
+	}
+	return 0, ErrMalformedRecord
+}
+
+// readStreamRecord reads a single record, returning io.EOF only at a record boundary
+func readStreamRecord(r *bufio.Reader) (kv KV, err error) {
+	size, err := readStreamSize(r)
+	if err != nil {
+		return kv, err
+	}
+	if size > maxStreamRecordSize {
+		return kv, ErrMalformedRecord
+	}
+	record, err := readStreamBytes(r, size)
+	if err != nil {
+		return kv, err
+	}
+	for len(record) > 0 {
+		tag := record[0]
+		n, read := binary.Uvarint(record[1:])
+		if read <= 0 || n > uint64(len(record)-1-read) {
+			return kv, ErrMalformedRecord
+		}
+		data := record[1+read : 1+read+int(n)]
+		switch tag {
+		case streamKeyTag:
+			kv.Key = data
+		case streamValueTag:
+			kv.Value = data
+		default:
+			return kv, ErrMalformedRecord
+		}
+		record = record[1+read+int(n):]
+	}
+	if len(kv.Key) == 0 {
+		return kv, ErrMalformedRecord
+	}
+	if kv.Value == nil {
+		// proto3 writers omit empty fields
+		kv.Value = []byte{}
+	}
+	return kv, nil
+}
+
+// PutStream puts the size bytes read from r as the value at key,
+// copying them directly into space reserved in the memory map with PutReserve
+//
+// If r yields fewer or more than size bytes, ErrStreamSize is returned and nothing is written.
+// r is read inside the write transaction, so a slow reader delays every other write
+//
+// The call will block until the transaction is finished
+//
+func (s *Db) PutStream(key []byte, r io.Reader, size int) error {
+	return s.PutReserve(key, size, func(buf []byte) error {
+		n, err := io.ReadFull(r, buf)
+		if err == io.ErrUnexpectedEOF || err == io.EOF {
+			return fmt.Errorf("%w: read %d of %d bytes", ErrStreamSize, n, size)
+		}
+		if err != nil {
+			return err
+		}
+		var extra [1]byte
+		_, err = io.ReadFull(r, extra[:])
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: reader has more than %d bytes", ErrStreamSize, size)
+	})
+}
@@ -0,0 +1,119 @@
+package lmdbstore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestStreamRoundTrip(t *testing.T) {
+	env := newTestEnv(t, DbConfig{DbName: "src"}, DbConfig{DbName: "dst"})
+	src, dst := env.GetDatabase("src"), env.GetDatabase("dst")
+	putNumbered(t, src, "key", 20)
+	mustPut(t, src, "large", make([]byte, 100000))
+	mustPut(t, src, "empty", []byte{})
+
+	var buf bytes.Buffer
+	for _, r := range [][2][]byte{{nil, []byte("key")}, {[]byte("key005"), []byte("key010")}, {[]byte("large"), nil}} {
+		if err := src.StreamTo(&buf, r[0], r[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := dst.StreamFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := "[empty key005 key006 key007 key008 key009 large]"
+	if got := fmt.Sprint(keysOf(t, dst)); got != want {
+		t.Fatalf("keys = %s, want %s", got, want)
+	}
+	if got := mustGet(t, dst, "large"); len(got) != 100000 {
+		t.Fatalf("large holds %d bytes", len(got))
+	}
+}
+
+func TestStreamFromTruncated(t *testing.T) {
+	env := newTestEnv(t, DbConfig{DbName: "src"}, DbConfig{DbName: "dst"})
+	src, dst := env.GetDatabase("src"), env.GetDatabase("dst")
+	putNumbered(t, src, "key", 3)
+	var buf bytes.Buffer
+	if err := src.StreamTo(&buf, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	stream := buf.Bytes()
+	for _, n := range []int{1, len(stream) / 2, len(stream) - 1} {
+		if err := dst.StreamFrom(bytes.NewReader(stream[:n])); err != ErrTruncatedStream {
+			t.Fatalf("stream cut at %d of %d bytes: %v, want ErrTruncatedStream", n, len(stream), err)
+		}
+	}
+}
+
+func TestStreamFromCorrupt(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	for _, test := range []struct {
+		name   string
+		stream []byte
+		want   error
+	}{
+		{"size past the record limit", []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}, ErrMalformedRecord},
+		{"size overflowing 64 bits", []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x02}, ErrMalformedRecord},
+		{"size without its last byte", []byte{0xff, 0xff}, ErrTruncatedStream},
+		{"large size with a short body", []byte{0xff, 0xff, 0xff, 0xff, 0x0f, 1, 2, 3}, ErrTruncatedStream},
+		{"unknown field tag", []byte{3, 0x7a, 1, 'k'}, ErrMalformedRecord},
+		{"field longer than the record", []byte{3, streamKeyTag, 5, 'k'}, ErrMalformedRecord},
+	} {
+		if err := db.StreamFrom(bytes.NewReader(test.stream)); err != test.want {
+			t.Fatalf("%s: %v, want %v", test.name, err, test.want)
+		}
+	}
+}
+
+func TestLoadFromProgress(t *testing.T) {
+	env := newTestEnv(t, DbConfig{DbName: "src"}, DbConfig{DbName: "dst"})
+	src, dst := env.GetDatabase("src"), env.GetDatabase("dst")
+	putNumbered(t, src, "key", 25)
+	var buf bytes.Buffer
+	if err := src.StreamTo(&buf, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	var calls []int
+	if err := dst.LoadFrom(&buf, 10, func(loaded int) { calls = append(calls, loaded) }); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(calls); got != "[10 20 25]" {
+		t.Fatalf("progress calls = %s, want [10 20 25]", got)
+	}
+	if got := len(keysOf(t, dst)); got != 25 {
+		t.Fatalf("loaded %d entries, want 25", got)
+	}
+	// progress is optional
+	if err := dst.LoadFrom(bytes.NewReader(nil), 0, nil); err != nil {
+		t.Fatalf("empty stream without progress: %v", err)
+	}
+}
+
+func TestPutStream(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	value := bytes.Repeat([]byte("0123456789"), 10000)
+	if err := db.PutStream([]byte("exact"), bytes.NewReader(value), len(value)); err != nil {
+		t.Fatal(err)
+	}
+	if got := mustGet(t, db, "exact"); got != string(value) {
+		t.Fatalf("stored %d bytes, want the %d streamed", len(got), len(value))
+	}
+	for _, test := range []struct {
+		name string
+		r    *bytes.Reader
+	}{
+		{"short read", bytes.NewReader(value[:100])},
+		{"empty reader", bytes.NewReader(nil)},
+		{"long read", bytes.NewReader(value)},
+	} {
+		if err := db.PutStream([]byte("bad"), test.r, 1000); !errors.Is(err, ErrStreamSize) {
+			t.Fatalf("%s: %v, want ErrStreamSize", test.name, err)
+		}
+		if _, err := db.Get([]byte("bad")); err != ErrNotFound {
+			t.Fatalf("%s: value written: %v", test.name, err)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package lmdbstore
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/bmatsuo/lmdb-go/lmdb"
+)
+
+// TimeKey encodes t as an 8 byte key that sorts in chronological order
+//
+// The key is t.UnixNano() in big-endian with the sign bit flipped,
+// so times before 1970 also sort correctly
+//
+func TimeKey(t time.Time) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(t.UnixNano())^(1<<63))
+	return key
+}
+
+// KeyTime decodes a key created by TimeKey
+func KeyTime(key []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(key)^(1<<63)))
+}
+
+// PutTime puts a value inside the database using t as the key
+//
+// The call will block until the transaction is finished
+//
+func (s *Db) PutTime(t time.Time, value interface{}) error {
+	return s.Put(TimeKey(t), value)
+}
+
+// GetTime marshals value at the key of t into &dest
+//
+// If the key does not exist, ErrNotFound is returned
+//
+func (s *Db) GetTime(t time.Time, dest interface{}) error {
+	return s.GetAndMarshal(TimeKey(t), dest)
+}
+
+// RangeTime calls fn in chronological order for every entry with from <= time < to
+//
+// The value passed to fn is only valid until fn returns, copy it to retain it.
+// Iteration stops at the first error returned by fn,
+// returning ErrStopIteration stops without an error
+//
+func (s *Db) RangeTime(from, to time.Time, fn func(t time.Time, value []byte) error) error {
+	return s.lmdbEnv.View(func(txn *lmdb.Txn) error {
+		return s.walkRange(txn, TimeKey(from), TimeKey(to), func(key, value []byte) error {
+			if len(key) != 8 {
+				return nil
+			}
+			return fn(KeyTime(key), value)
+		})
+	})
+}
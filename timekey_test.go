@@ -0,0 +1,52 @@
+package lmdbstore
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeKeysChronological(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "events"}).GetDatabase("events")
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	offsets := []time.Duration{3 * time.Hour, -time.Hour, 0, 2 * time.Nanosecond, -48 * time.Hour, time.Hour}
+	for _, offset := range offsets {
+		if err := db.PutTime(base.Add(offset), offset.String()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// times before 1970 sort before later times
+	if err := db.PutTime(time.Date(1960, 1, 1, 0, 0, 0, 0, time.UTC), "1960"); err != nil {
+		t.Fatal(err)
+	}
+
+	var got string
+	if err := db.GetTime(base.Add(-time.Hour), &got); err != nil || got != "-1h0m0s" {
+		t.Fatalf("GetTime: %q, %v", got, err)
+	}
+
+	var times []time.Time
+	err := db.RangeTime(time.Time{}, base.Add(24*time.Hour), func(ts time.Time, value []byte) error {
+		times = append(times, ts)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(times) != len(offsets)+1 {
+		t.Fatalf("ranged %d entries, want %d", len(times), len(offsets)+1)
+	}
+	for i := 1; i < len(times); i++ {
+		if !times[i-1].Before(times[i]) {
+			t.Fatalf("entry %d at %v is not before %v", i-1, times[i-1], times[i])
+		}
+	}
+
+	times = times[:0]
+	err = db.RangeTime(base, base.Add(3*time.Hour), func(ts time.Time, value []byte) error {
+		times = append(times, ts)
+		return nil
+	})
+	if err != nil || len(times) != 3 {
+		t.Fatalf("ranged %d entries in [base, base+3h), %v, want 3", len(times), err)
+	}
+}
@@ -0,0 +1,197 @@
+package lmdbstore
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/bmatsuo/lmdb-go/lmdb"
+)
+
+// ErrTTLNotEnabled is returned by TTL methods on a Db whose DbConfig.TTL is not set
+var ErrTTLNotEnabled = errors.New("ttl is not enabled for the database")
+
+// TTLEntry is a single entry written by Db.PutTTLBatch
+type TTLEntry struct {
+	Key   []byte
+	Value interface{}
+	TTL   time.Duration
+}
+
+// PutWithTTL puts a value with key inside the database that expires after ttl
+//
+// Expired keys are reported as ErrNotFound by Get and GetAndMarshal,
+// but the stored value is only removed by a later Put, Del or PurgeExpired
+//
+// The call will block until the transaction is finished
+//
+func (s *Db) PutWithTTL(key []byte, value interface{}, ttl time.Duration) error {
+	return s.PutTTLBatch([]TTLEntry{{Key: key, Value: value, TTL: ttl}})
+}
+
+// PutTTLBatch puts all entries inside the database in a single transaction,
+// each expiring after its own TTL
+//
+// A repeated key is handled by DbConfig.OnDuplicateKey.
+// If any entry fails to be marshaled or written, none of the entries are written
+//
+// The call will block until the transaction is finished
+//
+func (s *Db) PutTTLBatch(entries []TTLEntry) error {
+	if !s.ttl {
+		return ErrTTLNotEnabled
+	}
+	err := s.checkDuplicates(len(entries), func(i int) []byte { return entries[i].Key })
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.TTL <= 0 {
+			return errors.New("ttl must be positive")
+		}
+	}
+	now := time.Now()
+	return s.update(func(txn *lmdb.Txn) error {
+		for _, entry := range entries {
+			err := s.putValue(txn, entry.Key, entry.Value)
+			if err != nil {
+				return err
+			}
+			err = s.setExpiry(txn, entry.Key, now.Add(entry.TTL))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetWithExpiry returns the binary value at key and the time remaining until it expires
+//
+// remaining is 0 for keys written without a TTL.
+// If the key does not exist or has expired, ErrNotFound is returned
+//
+// The returned value is copied for safe use outside the lmdb.TxnOp
+//
+func (s *Db) GetWithExpiry(key []byte) (value []byte, remaining time.Duration, err error) {
+	if !s.ttl {
+		return nil, 0, ErrTTLNotEnabled
+	}
+	err = s.lmdbEnv.View(func(txn *lmdb.Txn) error {
+		bOri, err := s.get(txn, key)
+		if err != nil {
+			return err
+		}
+		deadline, ok, err := s.expiry(txn, key)
+		if err != nil {
+			return err
+		}
+		remaining = 0
+		if ok {
+			remaining = time.Until(deadline)
+			if remaining <= 0 {
+				return ErrNotFound
+			}
+		}
+		value = make([]byte, len(bOri))
+		copy(value, bOri)
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return value, remaining, nil
+}
+
+// PurgeExpired deletes every expired key inside the database
+//
+// Returns the number of keys deleted
+//
+// The call will block until the transaction is finished
+//
+func (s *Db) PurgeExpired() (purged int, err error) {
+	if !s.ttl {
+		return 0, ErrTTLNotEnabled
+	}
+	err = s.update(func(txn *lmdb.Txn) error {
+		purged = 0
+		cur, err := txn.OpenCursor(s.ttlDbi)
+		if err != nil {
+			return err
+		}
+		defer cur.Close()
+		now := time.Now().UnixNano()
+		var expiredKeys [][]byte
+		for k, v, err := cur.Get(nil, nil, lmdb.First); ; k, v, err = cur.Get(nil, nil, lmdb.Next) {
+			if lmdb.IsNotFound(err) {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			if int64(binary.BigEndian.Uint64(v)) <= now {
+				key := make([]byte, len(k))
+				copy(key, k)
+				expiredKeys = append(expiredKeys, key)
+			}
+		}
+		for _, key := range expiredKeys {
+			err = s.del(txn, key)
+			if err == ErrNotFound {
+				err = s.clearExpiry(txn, key)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		purged = len(expiredKeys)
+		return nil
+	})
+	return purged, err
+}
+
+// setExpiry records deadline as the expiry of key inside txn
+func (s *Db) setExpiry(txn *lmdb.Txn, key []byte, deadline time.Time) error {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(deadline.UnixNano()))
+	return txn.Put(s.ttlDbi, key, b, 0)
+}
+
+// expiry returns the deadline of key inside txn
+//
+// ok is false when the key has no expiry
+//
+func (s *Db) expiry(txn *lmdb.Txn, key []byte) (deadline time.Time, ok bool, err error) {
+	if !s.ttl {
+		return time.Time{}, false, nil
+	}
+	b, err := txn.Get(s.ttlDbi, key)
+	if lmdb.IsNotFound(err) {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(b))), true, nil
+}
+
+// expired reports whether key has an expiry that has passed
+func (s *Db) expired(txn *lmdb.Txn, key []byte) (bool, error) {
+	deadline, ok, err := s.expiry(txn, key)
+	if err != nil || !ok {
+		return false, err
+	}
+	return !time.Now().Before(deadline), nil
+}
+
+// clearExpiry removes any expiry recorded for key inside txn
+func (s *Db) clearExpiry(txn *lmdb.Txn, key []byte) error {
+	if !s.ttl {
+		return nil
+	}
+	err := txn.Del(s.ttlDbi, key, nil)
+	if lmdb.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
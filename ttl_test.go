@@ -0,0 +1,104 @@
+package lmdbstore
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPutTTLBatchDeadlines(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "cache", TTL: true}).GetDatabase("cache")
+	err := db.PutTTLBatch([]TTLEntry{
+		{Key: []byte("short"), Value: []byte("s"), TTL: 50 * time.Millisecond},
+		{Key: []byte("long"), Value: []byte("l"), TTL: time.Hour},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := mustGet(t, db, "short"); got != "s" {
+		t.Fatalf("short = %q before expiry", got)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if _, err := db.Get([]byte("short")); err != ErrNotFound {
+		t.Fatalf("short: %v after its ttl, want ErrNotFound", err)
+	}
+	if got := mustGet(t, db, "long"); got != "l" {
+		t.Fatalf("long = %q", got)
+	}
+}
+
+func TestPutTTLBatchRollback(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "cache", TTL: true}).GetDatabase("cache")
+	err := db.PutTTLBatch([]TTLEntry{
+		{Key: []byte("ok"), Value: []byte("v"), TTL: time.Hour},
+		{Key: []byte("bad"), Value: make(chan int), TTL: time.Hour},
+	})
+	if err == nil {
+		t.Fatal("unmarshalable value was accepted")
+	}
+	if _, err := db.Get([]byte("ok")); err != ErrNotFound {
+		t.Fatalf("ok: %v, want ErrNotFound after rollback", err)
+	}
+}
+
+func TestPutTTLBatchRequiresTTL(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	err := db.PutTTLBatch([]TTLEntry{{Key: []byte("k"), Value: []byte("v"), TTL: time.Hour}})
+	if err != ErrTTLNotEnabled {
+		t.Fatalf("err = %v, want ErrTTLNotEnabled", err)
+	}
+}
+
+func TestGetWithExpiry(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "cache", TTL: true}).GetDatabase("cache")
+	if err := db.PutWithTTL([]byte("fresh"), []byte("v"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.PutWithTTL([]byte("stale"), []byte("v"), 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	mustPut(t, db, "forever", []byte("v"))
+	time.Sleep(20 * time.Millisecond)
+
+	value, remaining, err := db.GetWithExpiry([]byte("fresh"))
+	if err != nil || string(value) != "v" {
+		t.Fatalf("fresh = %q, %v", value, err)
+	}
+	if remaining <= 59*time.Minute || remaining > time.Hour {
+		t.Fatalf("fresh remaining = %v, want close to 1h", remaining)
+	}
+	if _, _, err := db.ReadOnly().GetWithExpiry([]byte("stale")); err != ErrNotFound {
+		t.Fatalf("stale: %v, want ErrNotFound", err)
+	}
+	if _, remaining, err := db.GetWithExpiry([]byte("forever")); err != nil || remaining != 0 {
+		t.Fatalf("no TTL = %v, %v, want 0", remaining, err)
+	}
+
+	plain := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	if _, _, err := plain.GetWithExpiry([]byte("k")); err != ErrTTLNotEnabled {
+		t.Fatalf("without TTL: %v, want ErrTTLNotEnabled", err)
+	}
+}
+
+func TestDefaultTTL(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "cache", DefaultTTL: 200 * time.Millisecond}).GetDatabase("cache")
+	mustPut(t, db, "default", []byte("v"))
+	if err := db.PutWithTTL([]byte("override"), []byte("v"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	_, remaining, err := db.GetWithExpiry([]byte("default"))
+	if err != nil || remaining <= 0 || remaining > 200*time.Millisecond {
+		t.Fatalf("default remaining = %v, %v, want up to 200ms", remaining, err)
+	}
+	time.Sleep(250 * time.Millisecond)
+	if _, err := db.Get([]byte("default")); err != ErrNotFound {
+		t.Fatalf("Put without a TTL after DefaultTTL: %v, want ErrNotFound", err)
+	}
+	if got := mustGet(t, db, "override"); got != "v" {
+		t.Fatalf("PutWithTTL override = %q", got)
+	}
+	// rewriting a key resets its expiry to the default
+	mustPut(t, db, "override", []byte("v2"))
+	if _, remaining, err := db.GetWithExpiry([]byte("override")); err != nil || remaining > 200*time.Millisecond {
+		t.Fatalf("rewritten remaining = %v, %v, want up to 200ms", remaining, err)
+	}
+}
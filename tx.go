@@ -0,0 +1,149 @@
+package lmdbstore
+
+import (
+	"bytes"
+
+	"github.com/bmatsuo/lmdb-go/lmdb"
+)
+
+// Tx is a single write transaction spanning all databases of a LmdbEnv
+//
+// Tx is only valid inside the function passed to LmdbEnv.Transaction
+// and should not be retained or used from other goroutines
+//
+type Tx struct {
+	// Direct access to the underlying *lmdb.Txn
+	Txn *lmdb.Txn
+}
+
+// Transaction runs fn inside a single write transaction in the updater goroutine
+//
+// Reads done through Tx see the writes done earlier in the same transaction,
+// allowing read-check-then-write logic across multiple databases.
+//
+// If fn returns an error, all writes done through Tx are discarded.
+// fn may write through Tx.Txn directly, so the bloom filters of DbConfig.BloomFilter databases
+// are disabled until rebuilt with RebuildBloomFilter.
+// Writes through Tx.Txn are not recorded by LmdbEnvConfig.Changelog
+//
+// The call will block until the transaction is finished
+//
+func (l *LmdbEnv) Transaction(fn func(tx *Tx) error) error {
+	return l.updateTxn(func(txn *lmdb.Txn) error {
+		l.invalidateBloomFilters()
+		return fn(&Tx{Txn: txn})
+	})
+}
+
+// transaction is Transaction for internal callers writing only through Tx methods
+func (l *LmdbEnv) transaction(fn func(tx *Tx) error) error {
+	return l.updateTxn(func(txn *lmdb.Txn) error {
+		return fn(&Tx{Txn: txn})
+	})
+}
+
+// Get returns the binary value at key inside db
+//
+// If the key does not exist, ErrNotFound is returned
+//
+// The returned value is copied for safe use outside the transaction
+//
+func (tx *Tx) Get(db *Db, key []byte) ([]byte, error) {
+	bOri, err := db.get(tx.Txn, key)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, len(bOri))
+	copy(b, bOri)
+	return b, nil
+}
+
+// Put a value with key inside db
+//
+// Values other than []byte are marshaled with db's Marshal
+//
+func (tx *Tx) Put(db *Db, key []byte, value interface{}) error {
+	return db.putValue(tx.Txn, key, value)
+}
+
+// Del a value with key inside db
+func (tx *Tx) Del(db *Db, key []byte) error {
+	return db.del(tx.Txn, key)
+}
+
+// Move moves the value at key inside src to newKey inside dst in a single transaction
+//
+// A nil newKey keeps key. The stored bytes are moved as is without re-marshaling.
+// If the key does not exist in src, ErrNotFound is returned.
+// Moving a key onto itself, in the same database with an equal newKey, leaves it unchanged.
+// If writing to dst fails, src is left unchanged
+//
+// The call will block until the transaction is finished
+//
+func (l *LmdbEnv) Move(src, dst *Db, key []byte, newKey []byte) error {
+	if newKey == nil {
+		newKey = key
+	}
+	return l.transaction(func(tx *Tx) error {
+		b, err := tx.Get(src, key)
+		if err != nil {
+			return err
+		}
+		if src == dst && bytes.Equal(key, newKey) {
+			return nil
+		}
+		err = dst.put(tx.Txn, newKey, b, 0)
+		if err != nil {
+			return err
+		}
+		return src.del(tx.Txn, key)
+	})
+}
+
+// ReadTx is a single read transaction spanning all databases of a LmdbEnv
+//
+// ReadTx is only valid inside the function passed to LmdbEnv.View
+// and should not be retained or used from other goroutines
+//
+type ReadTx struct {
+	// Direct access to the underlying *lmdb.Txn
+	Txn *lmdb.Txn
+}
+
+// View runs fn inside a single read transaction on the calling goroutine
+//
+// Every read done through ReadTx sees the same snapshot of all databases,
+// writes committed while fn runs are not visible to it
+//
+func (l *LmdbEnv) View(fn func(tx *ReadTx) error) error {
+	return l.LmdbEnv.View(func(txn *lmdb.Txn) error {
+		return fn(&ReadTx{Txn: txn})
+	})
+}
+
+// Get returns the binary value at key inside db
+//
+// If the key does not exist, ErrNotFound is returned
+//
+// The returned value is copied for safe use outside the transaction
+//
+func (tx *ReadTx) Get(db *Db, key []byte) ([]byte, error) {
+	bOri, err := db.get(tx.Txn, key)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, len(bOri))
+	copy(b, bOri)
+	return b, nil
+}
+
+// ForEach calls fn in key order for every entry with start <= key < end inside db
+//
+// Empty start begins at the first key, nil end continues to the last key.
+// The slices passed to fn are only valid until fn returns, copy them to retain them.
+// Iteration stops at the first error returned by fn,
+// returning ErrStopIteration stops without an error
+//
+func (tx *ReadTx) ForEach(db *Db, start, end []byte, fn func(key, value []byte) error) error {
+	return db.walkRange(tx.Txn, start, end, fn)
+}
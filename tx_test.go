@@ -0,0 +1,178 @@
+package lmdbstore
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestTransactionReadCheckThenWrite(t *testing.T) {
+	env := newTestEnv(t, DbConfig{DbName: "stock"}, DbConfig{DbName: "orders"})
+	stock, orders := env.GetDatabase("stock"), env.GetDatabase("orders")
+	mustPut(t, stock, "apple", []byte("1"))
+
+	order := func(id string) error {
+		return env.Transaction(func(tx *Tx) error {
+			b, err := tx.Get(stock, []byte("apple"))
+			if err != nil {
+				return err
+			}
+			if string(b) == "0" {
+				return errors.New("out of stock")
+			}
+			err = tx.Put(stock, []byte("apple"), []byte("0"))
+			if err != nil {
+				return err
+			}
+			return tx.Put(orders, []byte(id), []byte("apple"))
+		})
+	}
+	if err := order("o1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := order("o2"); err == nil {
+		t.Fatal("second order succeeded without stock")
+	}
+	if got := mustGet(t, stock, "apple"); got != "0" {
+		t.Fatalf("stock = %q, want 0", got)
+	}
+	if got := mustGet(t, orders, "o1"); got != "apple" {
+		t.Fatalf("order o1 = %q", got)
+	}
+	if _, err := orders.Get([]byte("o2")); err != ErrNotFound {
+		t.Fatalf("order o2: %v, want ErrNotFound", err)
+	}
+}
+
+func TestTransactionRollback(t *testing.T) {
+	env := newTestEnv(t, DbConfig{DbName: "a"}, DbConfig{DbName: "b"})
+	a, b := env.GetDatabase("a"), env.GetDatabase("b")
+	errAbort := errors.New("abort")
+	err := env.Transaction(func(tx *Tx) error {
+		if err := tx.Put(a, []byte("k"), []byte("v")); err != nil {
+			return err
+		}
+		// writes earlier in the transaction are visible to it
+		if v, err := tx.Get(a, []byte("k")); err != nil || string(v) != "v" {
+			t.Errorf("read own write: %q, %v", v, err)
+		}
+		if err := tx.Put(b, []byte("k"), []byte("v")); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if err != errAbort {
+		t.Fatalf("err = %v, want errAbort", err)
+	}
+	for i, db := range []*Db{a, b} {
+		if _, err := db.Get([]byte("k")); err != ErrNotFound {
+			t.Fatalf("db %d: %v, want ErrNotFound after rollback", i, err)
+		}
+	}
+}
+
+func TestMove(t *testing.T) {
+	env := newTestEnv(t, DbConfig{DbName: "pending"}, DbConfig{DbName: "done"})
+	pending, done := env.GetDatabase("pending"), env.GetDatabase("done")
+	mustPut(t, pending, "job1", []byte("payload"))
+	mustPut(t, pending, "job2", []byte("payload"))
+
+	if err := env.Move(pending, done, []byte("job1"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pending.Get([]byte("job1")); err != ErrNotFound {
+		t.Fatalf("job1 left in pending: %v", err)
+	}
+	if got := mustGet(t, done, "job1"); got != "payload" {
+		t.Fatalf("job1 in done = %q", got)
+	}
+	if err := env.Move(pending, done, []byte("job2"), []byte("archived/job2")); err != nil {
+		t.Fatal(err)
+	}
+	if got := mustGet(t, done, "archived/job2"); got != "payload" {
+		t.Fatalf("renamed job2 = %q", got)
+	}
+	if err := env.Move(pending, done, []byte("absent"), nil); err != ErrNotFound {
+		t.Fatalf("absent: %v, want ErrNotFound", err)
+	}
+}
+
+func TestMoveRollback(t *testing.T) {
+	env := newTestEnv(t, DbConfig{DbName: "pending"}, DbConfig{DbName: "done"})
+	pending, done := env.GetDatabase("pending"), env.GetDatabase("done")
+	mustPut(t, pending, "job", []byte("payload"))
+	// lmdb rejects the empty key, failing the write to dst
+	if err := env.Move(pending, done, []byte("job"), []byte{}); err == nil {
+		t.Fatal("move to an empty key succeeded")
+	}
+	if got := mustGet(t, pending, "job"); got != "payload" {
+		t.Fatalf("job in pending = %q after a failed move", got)
+	}
+}
+
+func TestMoveOntoItself(t *testing.T) {
+	env := newTestEnv(t, DbConfig{DbName: "a"})
+	a := env.GetDatabase("a")
+	mustPut(t, a, "k", []byte("v"))
+	if err := env.Move(a, a, []byte("k"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.Move(a, a, []byte("k"), []byte("k")); err != nil {
+		t.Fatal(err)
+	}
+	if got := mustGet(t, a, "k"); got != "v" {
+		t.Fatalf("k = %q after moving onto itself", got)
+	}
+	if err := env.Move(a, a, []byte("k"), []byte("renamed")); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(keysOf(t, a)); got != "[renamed]" {
+		t.Fatalf("keys = %s", got)
+	}
+}
+
+func TestViewSnapshot(t *testing.T) {
+	env := newTestEnv(t, DbConfig{DbName: "a"}, DbConfig{DbName: "b"})
+	a, b := env.GetDatabase("a"), env.GetDatabase("b")
+	mustPut(t, a, "k", []byte("old"))
+	mustPut(t, b, "k", []byte("old"))
+
+	err := env.View(func(tx *ReadTx) error {
+		va, err := tx.Get(a, []byte("k"))
+		if err != nil {
+			return err
+		}
+		// commit a write to both databases while the read transaction is open
+		done := make(chan error)
+		go func() {
+			done <- env.Transaction(func(wtx *Tx) error {
+				if err := wtx.Put(a, []byte("k"), []byte("new")); err != nil {
+					return err
+				}
+				return wtx.Put(b, []byte("k"), []byte("new"))
+			})
+		}()
+		if err := <-done; err != nil {
+			return err
+		}
+		vb, err := tx.Get(b, []byte("k"))
+		if err != nil {
+			return err
+		}
+		if string(va) != "old" || string(vb) != "old" {
+			return fmt.Errorf("snapshot = %q, %q, want old, old", va, vb)
+		}
+		return tx.ForEach(b, nil, nil, func(key, value []byte) error {
+			if string(value) != "old" {
+				return fmt.Errorf("ForEach saw %q at %q", value, key)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := mustGet(t, a, "k") + " " + mustGet(t, b, "k"); got != "new new" {
+		t.Fatalf("after View = %q, want new new", got)
+	}
+}
@@ -0,0 +1,147 @@
+package lmdbstore
+
+import (
+	"github.com/bmatsuo/lmdb-go/lmdb"
+)
+
+// GetMany decodes the values at keys into a slice of T inside a single View
+//
+// values and errs have the same length and order as keys.
+// Missing keys leave the zero value of T in values with ErrNotFound in errs,
+// decoding failures are reported in errs likewise.
+//
+// err is only set when the View itself fails
+//
+func GetMany[T any](db *Db, keys [][]byte) (values []T, errs []error, err error) {
+	values = make([]T, len(keys))
+	errs = make([]error, len(keys))
+	err = db.lmdbEnv.View(func(txn *lmdb.Txn) error {
+		for i, key := range keys {
+			bOri, err := db.get(txn, key)
+			if err != nil {
+				errs[i] = err
+				continue
+			}
+			b := make([]byte, len(bOri))
+			copy(b, bOri)
+			errs[i] = db.decode(key, b, &values[i])
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return values, errs, nil
+}
+
+// GetOrZero decodes the value at key into a T
+//
+// If the key does not exist, the zero value of T is returned without an error,
+// errors are only returned for decoding or storage failures
+//
+func GetOrZero[T any](db *Db, key []byte) (value T, err error) {
+	err = db.lmdbEnv.View(func(txn *lmdb.Txn) error {
+		bOri, err := db.get(txn, key)
+		if err == ErrNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		b := make([]byte, len(bOri))
+		copy(b, bOri)
+		return db.decode(key, b, &value)
+	})
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return value, nil
+}
+
+// RangeDecode decodes every value with start <= key < end into a T and calls fn, in key order
+//
+// Empty start begins at the first key, nil end continues to the last key.
+// Iteration stops at the first decoding error or error returned by fn,
+// returning ErrStopIteration from fn stops without an error
+//
+// The key passed to fn is only valid until fn returns, the decoded value is safe to retain
+//
+func RangeDecode[T any](db *Db, start, end []byte, fn func(key []byte, v T) error) error {
+	return db.lmdbEnv.View(func(txn *lmdb.Txn) error {
+		return db.walkRange(txn, start, end, func(key, value []byte) error {
+			b := make([]byte, len(value))
+			copy(b, value)
+			var v T
+			err := db.decode(key, b, &v)
+			if err != nil {
+				return err
+			}
+			return fn(key, v)
+		})
+	})
+}
+
+// ModifyTyped decodes the value at key into a T, lets fn modify it and writes the result back,
+// all in a single transaction
+//
+// fn receives a pointer to the decoded value, or to the zero value of T with exists false
+// when the key does not exist. The value returned by fn is written at key,
+// returning nil deletes the key instead.
+// If fn returns an error, nothing is written
+//
+// The call will block until the transaction is finished
+//
+func ModifyTyped[T any](db *Db, key []byte, fn func(cur *T, exists bool) (*T, error)) error {
+	return db.update(func(txn *lmdb.Txn) error {
+		cur := new(T)
+		bOri, err := db.get(txn, key)
+		if err != nil && err != ErrNotFound {
+			return err
+		}
+		exists := err == nil
+		if exists {
+			b := make([]byte, len(bOri))
+			copy(b, bOri)
+			err = db.decode(key, b, cur)
+			if err != nil {
+				return err
+			}
+		}
+		next, err := fn(cur, exists)
+		if err != nil {
+			return err
+		}
+		if next == nil {
+			if !exists {
+				return nil
+			}
+			return db.del(txn, key)
+		}
+		return db.putValue(txn, key, *next)
+	})
+}
+
+// Fold calls fn in key order for every entry inside a single View,
+// passing the result of the previous call, starting from init
+//
+// The final result is returned. If fn returns an error, folding stops
+// and the result so far is returned along with the error
+//
+// The slices passed to fn are only valid until fn returns, copy them to retain them
+//
+func Fold[T any](db *Db, init T, fn func(acc T, key, value []byte) (T, error)) (T, error) {
+	acc := init
+	err := db.lmdbEnv.View(func(txn *lmdb.Txn) error {
+		acc = init
+		return db.walkRange(txn, nil, nil, func(key, value []byte) error {
+			next, err := fn(acc, key, value)
+			if err != nil {
+				return err
+			}
+			acc = next
+			return nil
+		})
+	})
+	return acc, err
+}
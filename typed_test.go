@@ -0,0 +1,159 @@
+package lmdbstore
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+type testRecord struct {
+	ID   int
+	Name string
+}
+
+func TestGetMany(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	mustPut(t, db, "1", testRecord{ID: 1, Name: "one"})
+	mustPut(t, db, "3", testRecord{ID: 3, Name: "three"})
+	mustPut(t, db, "bad", []byte{0xc1})
+
+	values, errs, err := GetMany[testRecord](db, [][]byte{[]byte("1"), []byte("2"), []byte("3"), []byte("bad")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 4 || len(errs) != 4 {
+		t.Fatalf("got %d values and %d errors, want 4", len(values), len(errs))
+	}
+	if errs[0] != nil || values[0] != (testRecord{ID: 1, Name: "one"}) {
+		t.Fatalf("key 1: %+v, %v", values[0], errs[0])
+	}
+	if errs[1] != ErrNotFound || values[1] != (testRecord{}) {
+		t.Fatalf("missing key 2: %+v, %v", values[1], errs[1])
+	}
+	if errs[2] != nil || values[2] != (testRecord{ID: 3, Name: "three"}) {
+		t.Fatalf("key 3: %+v, %v", values[2], errs[2])
+	}
+	if errs[3] == nil {
+		t.Fatal("undecodable value returned no error")
+	}
+}
+
+func TestRangeDecode(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	for i := 1; i <= 4; i++ {
+		mustPut(t, db, fmt.Sprintf("rec/%d", i), testRecord{ID: i, Name: fmt.Sprint("n", i)})
+	}
+	var ids []int
+	err := RangeDecode(db, []byte("rec/2"), []byte("rec/4"), func(key []byte, v testRecord) error {
+		ids = append(ids, v.ID)
+		return nil
+	})
+	if err != nil || fmt.Sprint(ids) != "[2 3]" {
+		t.Fatalf("ids = %v, %v", ids, err)
+	}
+
+	// a value that does not decode stops the range with its error
+	mustPut(t, db, "rec/3", []byte{0xc1})
+	ids = ids[:0]
+	err = RangeDecode(db, nil, nil, func(key []byte, v testRecord) error {
+		ids = append(ids, v.ID)
+		return nil
+	})
+	if err == nil || fmt.Sprint(ids) != "[1 2]" {
+		t.Fatalf("ids = %v, %v, want a decode error after 2", ids, err)
+	}
+}
+
+func TestModifyTyped(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	increment := func(cur *testRecord, exists bool) (*testRecord, error) {
+		if !exists {
+			cur.Name = "created"
+		}
+		cur.ID++
+		return cur, nil
+	}
+	// creates when absent, then increments
+	for i := 0; i < 3; i++ {
+		if err := ModifyTyped(db, []byte("counter"), increment); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var rec testRecord
+	if err := db.GetAndMarshal([]byte("counter"), &rec); err != nil || rec != (testRecord{ID: 3, Name: "created"}) {
+		t.Fatalf("counter = %+v, %v", rec, err)
+	}
+
+	errFn := errors.New("fn failed")
+	err := ModifyTyped(db, []byte("counter"), func(cur *testRecord, exists bool) (*testRecord, error) {
+		cur.ID = 100
+		return cur, errFn
+	})
+	if err != errFn {
+		t.Fatalf("err = %v, want the error of fn", err)
+	}
+	if err := db.GetAndMarshal([]byte("counter"), &rec); err != nil || rec.ID != 3 {
+		t.Fatalf("counter = %+v after a failed modify", rec)
+	}
+
+	err = ModifyTyped(db, []byte("counter"), func(cur *testRecord, exists bool) (*testRecord, error) {
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Get([]byte("counter")); err != ErrNotFound {
+		t.Fatalf("counter: %v after returning nil, want ErrNotFound", err)
+	}
+}
+
+func TestFold(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	putNumbered(t, db, "k", 5)
+	sum, err := Fold(db, 0, func(acc int, key, value []byte) (int, error) {
+		return acc + int(value[0]-'0'), nil
+	})
+	if err != nil || sum != 10 {
+		t.Fatalf("sum = %d, %v, want 10", sum, err)
+	}
+	keys, err := Fold(db, "", func(acc string, key, value []byte) (string, error) {
+		return acc + string(key), nil
+	})
+	if err != nil || keys != "k000k001k002k003k004" {
+		t.Fatalf("concatenation = %q, %v", keys, err)
+	}
+
+	errStop := errors.New("stop")
+	partial, err := Fold(db, 0, func(acc int, key, value []byte) (int, error) {
+		if string(key) == "k003" {
+			return -1, errStop
+		}
+		return acc + 1, nil
+	})
+	if err != errStop || partial != 3 {
+		t.Fatalf("error mid-fold = %d, %v, want 3, stop", partial, err)
+	}
+}
+
+func TestGetOrZero(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	mustPut(t, db, "rec", testRecord{ID: 1, Name: "one"})
+	mustPut(t, db, "bad", []byte{0xc1})
+
+	rec, err := GetOrZero[testRecord](db, []byte("rec"))
+	if err != nil || rec != (testRecord{ID: 1, Name: "one"}) {
+		t.Fatalf("present key = %+v, %v", rec, err)
+	}
+	rec, err = GetOrZero[testRecord](db, []byte("absent"))
+	if err != nil || rec != (testRecord{}) {
+		t.Fatalf("absent key = %+v, %v, want the zero value", rec, err)
+	}
+	ptr, err := GetOrZero[*testRecord](db, []byte("absent"))
+	if err != nil || ptr != nil {
+		t.Fatalf("absent key into a pointer = %v, %v, want nil", ptr, err)
+	}
+	rec, err = GetOrZero[testRecord](db, []byte("bad"))
+	if err == nil || rec != (testRecord{}) {
+		t.Fatalf("undecodable value = %+v, %v, want an error and the zero value", rec, err)
+	}
+}
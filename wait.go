@@ -0,0 +1,50 @@
+package lmdbstore
+
+import (
+	"context"
+	"time"
+)
+
+// waitForKeyInterval is how often WaitForKey polls for the key
+const waitForKeyInterval = 10 * time.Millisecond
+
+// WaitForKey blocks until key exists inside the database and returns its value
+//
+// The database is polled every 10ms, so the value is returned shortly after it is written.
+// If ctx is done first, ctx.Err() is returned.
+// If the LmdbEnv is closed first, ErrClosed is returned
+//
+// The returned value is copied for safe use outside the lmdb.TxnOp
+//
+func (s *Db) WaitForKey(ctx context.Context, key []byte) ([]byte, error) {
+	ticker := time.NewTicker(waitForKeyInterval)
+	defer ticker.Stop()
+	for {
+		value, ok, err := s.lookupOpen(key)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return value, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-s.env.closingChan:
+			return nil, ErrClosed
+		case <-ticker.C:
+		}
+	}
+}
+
+// lookupOpen is Lookup returning ErrClosed instead once Close has started
+func (s *Db) lookupOpen(key []byte) (value []byte, ok bool, err error) {
+	s.env.closeMu.RLock()
+	defer s.env.closeMu.RUnlock()
+	select {
+	case <-s.env.closingChan:
+		return nil, false, ErrClosed
+	default:
+	}
+	return s.Lookup(key)
+}
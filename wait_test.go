@@ -0,0 +1,83 @@
+package lmdbstore
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWaitForKey(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		db.Put([]byte("ready"), []byte("go"))
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	b, err := db.WaitForKey(ctx, []byte("ready"))
+	if err != nil || string(b) != "go" {
+		t.Fatalf("WaitForKey = %q, %v", b, err)
+	}
+	// an existing key returns immediately
+	b, err = db.WaitForKey(ctx, []byte("ready"))
+	if err != nil || string(b) != "go" {
+		t.Fatalf("existing key = %q, %v", b, err)
+	}
+}
+
+func TestWaitForKeyTimeout(t *testing.T) {
+	db := newTestEnv(t, DbConfig{DbName: "a"}).GetDatabase("a")
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	if _, err := db.WaitForKey(ctx, []byte("never")); err != context.DeadlineExceeded {
+		t.Fatalf("err = %v, want DeadlineExceeded", err)
+	}
+}
+
+func TestWaitForKeyClose(t *testing.T) {
+	env := newTestEnv(t, DbConfig{DbName: "a"})
+	done := make(chan error)
+	go func() {
+		_, err := env.GetDatabase("a").WaitForKey(context.Background(), []byte("never"))
+		done <- err
+	}()
+	time.Sleep(30 * time.Millisecond)
+	env.Close()
+	select {
+	case err := <-done:
+		if err != ErrClosed {
+			t.Fatalf("err = %v, want ErrClosed", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("WaitForKey did not return on Close")
+	}
+}
+
+func TestWaitForKeyAfterClose(t *testing.T) {
+	env := newTestEnv(t, DbConfig{DbName: "a"})
+	db := env.GetDatabase("a")
+	done := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			_, err := db.WaitForKey(context.Background(), []byte("never"))
+			done <- err
+		}()
+	}
+	time.Sleep(30 * time.Millisecond)
+	env.Close()
+	// Close is idempotent
+	env.Close()
+	for i := 0; i < 3; i++ {
+		select {
+		case err := <-done:
+			if err != ErrClosed {
+				t.Fatalf("waiter %d: %v, want ErrClosed", i, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("waiter %d did not return on Close", i)
+		}
+	}
+	if _, err := db.WaitForKey(context.Background(), []byte("never")); err != ErrClosed {
+		t.Fatalf("WaitForKey after Close: %v, want ErrClosed", err)
+	}
+}